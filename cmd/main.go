@@ -7,7 +7,9 @@ package main
 import (
 
 	// Stdlib
+	"context"
 	"flag"
+	"os"
 	"sync"
 	"time"
 
@@ -47,6 +49,18 @@ func initFlags(fs *pflag.FlagSet) *common.FlagPack {
 		"informer-bind-address", ":8083",
 		"The address the informer binds to.")
 
+	fs.StringVar(
+		&flags.InformerRemoteSecretsNamespace,
+		"informer-remote-secrets-namespace",
+		"",
+		"If set, the informer also lists the swarm Services of the remote clusters whose kubeconfigs are in the Secrets of this namespace labeled k-swarm/multi-cluster=true, one data key per cluster name.")
+
+	fs.StringVar(
+		&flags.InformerUnreadyServices,
+		"informer-unready-services",
+		"drop",
+		"What the informer does with swarm Services without ready endpoints: 'drop' leaves them out of the service lists, 'mark' keeps them, with readyEndpoints set to 0 in /v1/services, so workers can tell expected failures apart.")
+
 	fs.StringVar(
 		&flags.MetricsAddr,
 		"metrics-bind-address",
@@ -101,6 +115,12 @@ func initFlags(fs *pflag.FlagSet) *common.FlagPack {
 		false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
 
+	fs.DurationVar(
+		&flags.ShutdownDrainPeriod,
+		"shutdown-drain-period",
+		5*time.Second,
+		"How long the informer and worker servers keep serving after a shutdown signal, with readiness failing, before they stop and let in-flight requests complete.")
+
 	//--------------
 	// Worker flags
 	//--------------
@@ -116,6 +136,55 @@ func initFlags(fs *pflag.FlagSet) *common.FlagPack {
 		"worker-bind-address", ":8082",
 		"The address the worker binds to.")
 
+	fs.StringVar(
+		&flags.WorkerMetricsAddr,
+		"worker-metrics-bind-address", ":8084",
+		"The address the worker metrics endpoint binds to. Set this to '0' to disable the worker metrics server, which requires --worker-health-probe-bind-address.")
+
+	fs.StringVar(
+		&flags.WorkerProbeAddr,
+		"worker-health-probe-bind-address", "",
+		"The address the worker /healthz and /readyz probes bind to. Empty serves them on the worker metrics server; '0' disables them.")
+
+	fs.StringVar(
+		&flags.WorkerAdminAddr,
+		"worker-admin-bind-address", "0",
+		"The address the unauthenticated worker admin endpoint, which changes the fault config at runtime, binds to (e.g. 127.0.0.1:8087). Defaults to '0', which disables it.")
+
+	fs.StringVar(
+		&flags.WorkerGRPCBindAddr,
+		"worker-grpc-bind-address", ":8085",
+		"The address the worker gRPC server binds to. Set this to '0' to disable the worker gRPC server.")
+
+	fs.StringVar(
+		&flags.WorkerTCPBindAddr,
+		"worker-tcp-bind-address", ":8086",
+		"The address the worker TCP echo server binds to. Set this to '0' to disable the worker TCP server.")
+
+	fs.IntVar(
+		&flags.WorkerTCPPayloadSize,
+		"worker-tcp-payload-size",
+		64,
+		"The payload size, in bytes, of every frame sent in 'tcp' protocol mode, up to 1048576.")
+
+	fs.IntVar(
+		&flags.WorkerTCPFrames,
+		"worker-tcp-frames",
+		1,
+		"The number of frames exchanged over each connection in 'tcp' protocol mode, at least 1.")
+
+	fs.DurationVar(
+		&flags.WorkerStreamIdleTimeout,
+		"worker-stream-idle-timeout",
+		time.Minute,
+		"How long a 'websocket' stream may go without hearing from its peer before it is cut as timed out; streams ping every third of it. Must be positive.")
+
+	fs.StringVar(
+		&flags.WorkerProtocol,
+		"worker-protocol",
+		"http",
+		"The protocol the worker uses to call its peers: 'http', 'grpc' or 'tcp', each targeting the Service ports with the same name, or 'websocket', which holds a stream to every http port.")
+
 	fs.StringVar(
 		&flags.InformerURL,
 		"informer-url",
@@ -126,19 +195,307 @@ func initFlags(fs *pflag.FlagSet) *common.FlagPack {
 		&flags.InformerPollInterval,
 		"informer-poll-interval",
 		10*time.Second,
-		"The interval at which the worker polls the informer.")
+		"The interval at which the worker polls the informer. With --informer-watch, polls are skipped while the watch stream is up.")
+
+	fs.BoolVar(
+		&flags.InformerWatch,
+		"informer-watch",
+		true,
+		"If set, the worker watches the informer for service updates pushed as Server-Sent Events, falling back to polling while the stream is down.")
 
 	fs.DurationVar(
 		&flags.WorkerRequestInterval,
 		"worker-request-interval",
 		2*time.Second,
-		"The interval at which the worker sends requests.")
+		"The interval at which the worker sends requests. Ignored when --worker-rate is set.")
+
+	fs.Float64Var(
+		&flags.WorkerRate,
+		"worker-rate",
+		0,
+		"The target number of requests per second, applied per destination or per worker depending on --worker-rate-mode. Defaults to 1/--worker-request-interval.")
+
+	fs.StringVar(
+		&flags.WorkerRateMode,
+		"worker-rate-mode",
+		"per-worker",
+		"How --worker-rate is applied: 'per-worker' spreads it across all destinations, 'per-destination' sends it to every destination.")
+
+	fs.IntVar(
+		&flags.WorkerConcurrency,
+		"worker-concurrency",
+		10,
+		"The maximum number of requests the worker has in flight at any time.")
+
+	fs.StringVar(
+		&flags.WorkerDestinationStrategy,
+		"worker-destination-strategy",
+		"round-robin",
+		"How the per-worker dispatcher picks destinations: 'round-robin', 'random', 'weighted', 'zipf' or 'locality'.")
+
+	fs.StringToIntVar(
+		&flags.WorkerDestinationWeights,
+		"worker-destination-weights",
+		nil,
+		"Weights of the 'weighted' strategy as key=weight pairs, keyed by service address, host or namespace. Unlisted services weigh 1.")
+
+	fs.Float64Var(
+		&flags.WorkerDestinationZipfExponent,
+		"worker-destination-zipf-exponent",
+		1,
+		"Exponent of the 'zipf' strategy: the destination ranked k in informer order is picked with weight 1/k^exponent.")
+
+	fs.Float64Var(
+		&flags.WorkerDestinationLocalityBias,
+		"worker-destination-locality-bias",
+		0.9,
+		"The fraction, in [0, 1], of requests the 'locality' strategy sends to destinations in the worker's own cluster.")
+
+	fs.StringVar(
+		&flags.WorkerProfile,
+		"worker-profile",
+		"constant",
+		"The shape of the request rate over time: 'constant', 'ramp', 'burst', 'sine' or 'poisson'.")
+
+	fs.DurationVar(
+		&flags.WorkerProfilePeriod,
+		"worker-profile-period",
+		10*time.Minute,
+		"The ramp-up duration of the 'ramp' profile, or the cycle length of the 'burst' and 'sine' profiles.")
+
+	fs.DurationVar(
+		&flags.WorkerProfileBurstDuration,
+		"worker-profile-burst-duration",
+		30*time.Second,
+		"How long each burst of the 'burst' profile lasts, at the start of every period.")
+
+	fs.Float64Var(
+		&flags.WorkerProfileBurstFactor,
+		"worker-profile-burst-factor",
+		10,
+		"The rate multiplier applied during a burst of the 'burst' profile.")
+
+	fs.Float64Var(
+		&flags.WorkerProfileAmplitude,
+		"worker-profile-amplitude",
+		0.5,
+		"The relative amplitude, in [0, 1], of the 'sine' profile around the base rate.")
+
+	fs.Float64Var(
+		&flags.WorkerProfileJitter,
+		"worker-profile-jitter",
+		0,
+		"Randomize every inter-arrival time by up to this fraction, in [0, 1), on top of any profile.")
+
+	fs.Float64Var(
+		&flags.WorkerFaultErrorRate,
+		"worker-fault-error-rate",
+		0,
+		"The fraction, in [0, 1], of /data requests answered with one of --worker-fault-error-codes.")
+
+	fs.IntSliceVar(
+		&flags.WorkerFaultErrorCodes,
+		"worker-fault-error-codes",
+		[]int{503},
+		"The 4xx/5xx status codes injected errors are drawn from, uniformly.")
+
+	fs.Float64Var(
+		&flags.WorkerFaultDelayRate,
+		"worker-fault-delay-rate",
+		1,
+		"The fraction, in [0, 1], of /data requests delayed by --worker-fault-delay.")
+
+	fs.DurationVar(
+		&flags.WorkerFaultDelay,
+		"worker-fault-delay",
+		0,
+		"The latency added to delayed /data requests: the fixed value, or the mean of the distribution.")
+
+	fs.StringVar(
+		&flags.WorkerFaultDelayDistribution,
+		"worker-fault-delay-distribution",
+		"fixed",
+		"The distribution injected delays are drawn from: 'fixed', 'uniform', 'normal' or 'exponential'.")
+
+	fs.DurationVar(
+		&flags.WorkerFaultDelaySpread,
+		"worker-fault-delay-spread",
+		0,
+		"The half-width of the 'uniform' delay distribution, or the standard deviation of the 'normal' one.")
+
+	fs.Float64Var(
+		&flags.WorkerFaultResetRate,
+		"worker-fault-reset-rate",
+		0,
+		"The fraction, in [0, 1], of /data requests answered with a TCP reset.")
+
+	fs.Float64Var(
+		&flags.WorkerFaultPartialRate,
+		"worker-fault-partial-rate",
+		0,
+		"The fraction, in [0, 1], of /data requests answered with a truncated body.")
+
+	fs.DurationVar(
+		&flags.WorkerRequestTimeout,
+		"worker-request-timeout",
+		5*time.Second,
+		"The timeout of every attempt to call a peer, and of every informer poll. 0 disables it.")
+
+	fs.IntVar(
+		&flags.WorkerRetries,
+		"worker-retries",
+		0,
+		"How many times the worker retries a call that failed at the transport level or returned 5xx or 429.")
+
+	fs.DurationVar(
+		&flags.WorkerRetryBackoff,
+		"worker-retry-backoff",
+		100*time.Millisecond,
+		"The wait before the first retry, doubled on every further retry and jittered.")
+
+	fs.DurationVar(
+		&flags.WorkerRetryMaxBackoff,
+		"worker-retry-max-backoff",
+		2*time.Second,
+		"The maximum wait between retries.")
+
+	fs.DurationVar(
+		&flags.WorkerHedgeDelay,
+		"worker-hedge-delay",
+		0,
+		"If set, send a second, hedged attempt when the first one has not completed after this long. 0 disables hedging.")
+
+	fs.StringVar(
+		&flags.WorkerConnMode,
+		"worker-conn-mode",
+		"pool",
+		"How the worker HTTP client manages connections: pool, new or recycle.")
+
+	fs.IntVar(
+		&flags.WorkerConnMaxIdle,
+		"worker-conn-max-idle",
+		2,
+		"The maximum number of idle connections kept per peer in pool and recycle modes.")
+
+	fs.IntVar(
+		&flags.WorkerConnMaxPerHost,
+		"worker-conn-max-per-host",
+		0,
+		"The maximum number of connections per peer, idle or not. 0 means no limit.")
+
+	fs.DurationVar(
+		&flags.WorkerConnIdleTimeout,
+		"worker-conn-idle-timeout",
+		90*time.Second,
+		"How long an idle connection is kept in pool and recycle modes. 0 means no limit.")
+
+	fs.DurationVar(
+		&flags.WorkerConnRecycleInterval,
+		"worker-conn-recycle-interval",
+		time.Minute,
+		"How often the connection pool is replaced in recycle mode, forcing reconnects.")
+
+	fs.IntVar(
+		&flags.WorkerChainDepth,
+		"worker-chain-depth",
+		0,
+		"How many more times peers forward each /data request, building a call chain. 0 disables chains.")
+
+	fs.IntVar(
+		&flags.WorkerChainFanout,
+		"worker-chain-fanout",
+		1,
+		"How many random peers every hop of a call chain forwards the request to.")
+
+	fs.StringVar(
+		&flags.WorkerTracingEndpoint,
+		"worker-tracing-endpoint",
+		"",
+		"The OTLP/gRPC collector (host:port) worker spans are exported to. Empty disables exporting; trace context is propagated regardless.")
+
+	fs.Float64Var(
+		&flags.WorkerTracingSampleRatio,
+		"worker-tracing-sample-ratio",
+		1,
+		"The fraction, in [0, 1], of traces started by the worker that are sampled. Incoming sampling decisions are honoured.")
+
+	fs.StringVar(
+		&flags.WorkerTLSCertFile,
+		"worker-tls-cert-file",
+		"",
+		"The certificate file the worker serves /data over TLS with and presents to peers. Enables TLS together with --worker-tls-key-file.")
+
+	fs.StringVar(
+		&flags.WorkerTLSKeyFile,
+		"worker-tls-key-file",
+		"",
+		"The private key file matching --worker-tls-cert-file.")
+
+	fs.StringVar(
+		&flags.WorkerTLSCAFile,
+		"worker-tls-ca-file",
+		"",
+		"The CA bundle peer certificates are verified against. Defaults to the system roots.")
+
+	fs.BoolVar(
+		&flags.WorkerTLSClientAuth,
+		"worker-tls-client-auth",
+		false,
+		"If set, the worker server requires client certificates signed by --worker-tls-ca-file (mTLS).")
 
 	fs.BoolVar(
 		&flags.WorkerLogResponses,
 		"worker-log-responses",
 		false,
-		"If set, log the raw JSON response bodies received from the informer's /services endpoint and from peer workers' /data endpoint.")
+		"If set, log the raw JSON response bodies received from the informer's service list endpoints and from peer workers' /data endpoint.")
+
+	fs.DurationVar(
+		&flags.WorkerStatsWindow,
+		"worker-stats-window",
+		5*time.Minute,
+		"The rolling window the per-destination stats served at /stats are computed over.")
+
+	fs.IntVar(
+		&flags.WorkerStatsSamples,
+		"worker-stats-samples",
+		1000,
+		"The maximum number of hop results kept per destination for /stats.")
+
+	fs.Float64Var(
+		&flags.WorkerReadyMinReachable,
+		"worker-ready-min-reachable",
+		0,
+		"The minimum fraction, in [0, 1], of peers that must have answered successfully within --worker-stats-window for the worker's /readyz to pass. 0 disables the check.")
+
+	fs.StringVar(
+		&flags.WorkerScenario,
+		"worker-scenario",
+		"",
+		"A YAML or JSON traffic scenario, as a file path or an http(s) URL, describing which destinations to call and how. Empty leaves the traffic to the flags.")
+
+	fs.DurationVar(
+		&flags.WorkerScenarioReloadInterval,
+		"worker-scenario-reload-interval",
+		10*time.Second,
+		"How often the worker re-reads --worker-scenario and applies it if it changed.")
+
+	fs.StringVar(
+		&flags.WorkerRecords,
+		"worker-records",
+		"",
+		"Where the worker writes a JSON Lines record of every hop: 'stdout' or a file path. Empty disables the records.")
+
+	fs.IntVar(
+		&flags.WorkerRecordsMaxSizeMB,
+		"worker-records-max-size-mb",
+		100,
+		"The size, in megabytes, at which the --worker-records file is rotated.")
+
+	fs.IntVar(
+		&flags.WorkerRecordsMaxFiles,
+		"worker-records-max-files",
+		5,
+		"The number of rotated --worker-records files kept.")
 
 	return flags
 }
@@ -163,8 +520,10 @@ func main() {
 	ctrl.SetLogger(log)
 	ctrl.Log.WithName("main").Info("Starting")
 
-	// Setup a common context
-	ctx := ctrl.SetupSignalHandler()
+	// Setup a common context, also cancelled when the worker fails so that
+	// the informer and the controllers stop too
+	ctx, cancel := context.WithCancel(ctrl.SetupSignalHandler())
+	defer cancel()
 
 	// Run as an informer
 	if flags.EnableInformer {
@@ -174,13 +533,26 @@ func main() {
 	}
 
 	// Run as a worker
+	workerErr := make(chan error, 1)
 	if flags.EnableWorker {
 		wg.Add(1)
 		ctrl.Log.WithName("main").Info("Starting peer")
-		go worker.Start(ctx, &wg, flags)
+		go func() {
+			err := worker.Start(ctx, &wg, flags)
+			if err != nil {
+				cancel()
+			}
+			workerErr <- err
+		}()
 	}
 
-	// Wait
+	// Wait, exiting non-zero when the worker failed
 	wg.Wait()
+	if flags.EnableWorker {
+		if err := <-workerErr; err != nil {
+			ctrl.Log.WithName("main").Error(err, "worker failed")
+			os.Exit(1)
+		}
+	}
 	ctrl.Log.WithName("main").Info("Shutting down")
 }
@@ -8,10 +8,14 @@ import (
 
 	// Stdlib
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	// Community
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	// Local
 	"github.com/h0tbird/k-swarm/cmd/swarmctl/pkg/k8sctx"
@@ -117,12 +121,133 @@ func init() {
 		c.PersistentFlags().Bool("dry-run", false, "Render manifests to stdout without applying them or contacting the cluster.")
 
 		// --multi-cluster flag
-		c.PersistentFlags().Bool("multi-cluster", false, "Enable cross-cluster failover: labels the peer Service (and ambient waypoint Service) with istio.io/global=true and emits a DestinationRule with locality failover by topology.istio.io/cluster. Works for both ambient and sidecar dataplane modes.")
+		c.PersistentFlags().Bool("multi-cluster", false, "Enable cross-cluster failover: labels the peer Service (and ambient waypoint Service) with istio.io/global=true and emits a DestinationRule with locality failover by topology.istio.io/cluster, with one subset per cluster that a VirtualService routes x-k-swarm-cluster calls to. Works for both ambient and sidecar dataplane modes.")
 
 		// --log-responses flag
-		c.PersistentFlags().Bool("log-responses", false, "If set, the worker logs the raw JSON response bodies received from the informer's /services endpoint and from peer pods' /data endpoint.")
+		c.PersistentFlags().Bool("log-responses", false, "If set, the worker logs the raw JSON response bodies received from the informer's service list endpoints and from peer pods' /data endpoint.")
 	}
 
+	//---------------------------
+	// informer flags
+	//---------------------------
+
+	// --remote-secrets-namespace flag
+	informerCmd.PersistentFlags().String("remote-secrets-namespace", "", "Federate remote clusters: the informer also lists the swarm Services of every cluster whose kubeconfig is in a Secret of this existing namespace labeled k-swarm/multi-cluster=true, one data key per cluster name.")
+
+	// --unready-services flag
+	informerCmd.PersistentFlags().String("unready-services", "", "Services without ready endpoints: 'drop' leaves them out of the service lists, 'mark' keeps them with readyEndpoints set to 0 so workers count their failures as expected. Defaults to the manager default.")
+	if err := informerCmd.RegisterFlagCompletionFunc("unready-services", unreadyServicesCompletion); err != nil {
+		panic(err)
+	}
+
+	//---------------------------
+	// worker flags
+	//---------------------------
+
+	// Registered on workerCmd only; they render into the worker's manager
+	// args and have no meaning for the informer.
+
+	// --protocol flag
+	workerCmd.PersistentFlags().String("protocol", "", "Protocol used to call peers: 'http', 'grpc', 'tcp' or 'websocket' (default: the manager's default).")
+	if err := workerCmd.RegisterFlagCompletionFunc("protocol", protocolCompletion); err != nil {
+		panic(err)
+	}
+
+	// --rate flag
+	workerCmd.PersistentFlags().Float64("rate", 0, "Target requests per second sent by each worker pod (default: the manager's --worker-request-interval).")
+
+	// --rate-mode flag
+	workerCmd.PersistentFlags().String("rate-mode", "", "How --rate is applied: 'per-worker' (spread across all destinations) or 'per-destination' (sent to every destination).")
+	if err := workerCmd.RegisterFlagCompletionFunc("rate-mode", rateModeCompletion); err != nil {
+		panic(err)
+	}
+
+	// --concurrency flag
+	workerCmd.PersistentFlags().Int("concurrency", 0, "Maximum number of in-flight requests per worker pod (default: the manager's default).")
+
+	// --destination-* knobs
+	workerCmd.PersistentFlags().String("destination-strategy", "", "How destinations are picked in 'per-worker' rate mode: 'round-robin', 'random', 'weighted', 'zipf' or 'locality' (default: the manager's default).")
+	if err := workerCmd.RegisterFlagCompletionFunc("destination-strategy", destinationStrategyCompletion); err != nil {
+		panic(err)
+	}
+	workerCmd.PersistentFlags().String("destination-weights", "", "Comma-separated key=weight pairs of the 'weighted' strategy, keyed by service address, host or namespace.")
+	workerCmd.PersistentFlags().Float64("destination-zipf-exponent", 0, "Exponent of the 'zipf' strategy (default: the manager's default).")
+	workerCmd.PersistentFlags().Float64("destination-locality-bias", 0, "Fraction, in [0, 1], of requests the 'locality' strategy keeps in the worker's own cluster (default: the manager's default).")
+
+	// --profile flag
+	workerCmd.PersistentFlags().String("profile", "", "Traffic profile: 'constant', 'ramp', 'burst', 'sine' or 'poisson' (default: the manager's default).")
+	if err := workerCmd.RegisterFlagCompletionFunc("profile", profileCompletion); err != nil {
+		panic(err)
+	}
+
+	// --profile-* knobs
+	workerCmd.PersistentFlags().Duration("profile-period", 0, "Ramp-up duration of the 'ramp' profile, or cycle length of the 'burst' and 'sine' profiles.")
+	workerCmd.PersistentFlags().Duration("profile-burst-duration", 0, "Length of each burst of the 'burst' profile.")
+	workerCmd.PersistentFlags().Float64("profile-burst-factor", 0, "Rate multiplier applied during a burst of the 'burst' profile.")
+	workerCmd.PersistentFlags().Float64("profile-amplitude", 0, "Relative amplitude, in [0, 1], of the 'sine' profile.")
+	workerCmd.PersistentFlags().Float64("profile-jitter", 0, "Randomize every inter-arrival time by up to this fraction, in [0, 1).")
+
+	// --request-timeout, --retry-* and --hedge-delay knobs
+	workerCmd.PersistentFlags().Duration("request-timeout", 0, "Timeout of every attempt to call a peer, 0 for none (default: the manager's default).")
+	workerCmd.PersistentFlags().Int("retries", 0, "How many times a call that failed or returned 5xx or 429 is retried by the worker (default: no retries).")
+	workerCmd.PersistentFlags().Duration("retry-backoff", 0, "Wait before the first retry, doubled on every further retry (default: the manager's default).")
+	workerCmd.PersistentFlags().Duration("retry-max-backoff", 0, "Maximum wait between retries (default: the manager's default).")
+	workerCmd.PersistentFlags().Duration("hedge-delay", 0, "Send a hedged attempt when the first one has not completed after this long (default: no hedging).")
+
+	// --conn-* knobs
+	workerCmd.PersistentFlags().String("conn-mode", "", "How the worker HTTP client manages connections: 'pool', 'new' or 'recycle' (default: the manager's default).")
+	if err := workerCmd.RegisterFlagCompletionFunc("conn-mode", connModeCompletion); err != nil {
+		panic(err)
+	}
+	workerCmd.PersistentFlags().Int("conn-max-idle", 0, "Maximum number of idle connections kept per peer (default: the manager's default).")
+	workerCmd.PersistentFlags().Int("conn-max-per-host", 0, "Maximum number of connections per peer, idle or not (default: no limit).")
+	workerCmd.PersistentFlags().Duration("conn-idle-timeout", 0, "How long an idle connection is kept, 0 for no limit (default: the manager's default).")
+	workerCmd.PersistentFlags().Duration("conn-recycle-interval", 0, "How often the 'recycle' mode replaces the connection pool (default: the manager's default).")
+
+	// --chain-* knobs
+	workerCmd.PersistentFlags().Int("chain-depth", 0, "How many more times peers forward each /data request, building a call chain (default: no chains).")
+	workerCmd.PersistentFlags().Int("chain-fanout", 0, "How many random peers every hop of a call chain forwards the request to (default: the manager's default).")
+
+	// --tracing-* knobs
+	workerCmd.PersistentFlags().String("tracing-endpoint", "", "OTLP/gRPC collector (host:port) worker spans are exported to (default: not exported).")
+	workerCmd.PersistentFlags().Float64("tracing-sample-ratio", 0, "Fraction, in [0, 1], of traces started by the worker that are sampled (default: the manager's default).")
+
+	// --stats-* knobs
+	workerCmd.PersistentFlags().Duration("stats-window", 0, "Rolling window of the per-destination stats served at /stats (default: the manager's default).")
+	workerCmd.PersistentFlags().Int("stats-samples", 0, "Maximum number of hop results kept per destination for /stats (default: the manager's default).")
+
+	// --records flag
+	workerCmd.PersistentFlags().String("records", "", "Write a JSON Lines record of every hop: 'stdout' or 'file' (rotated files on an emptyDir volume) (default: none).")
+	if err := workerCmd.RegisterFlagCompletionFunc("records", recordsCompletion); err != nil {
+		panic(err)
+	}
+
+	// --scenario flag
+	workerCmd.PersistentFlags().String("scenario", "", "YAML or JSON traffic scenario the workers load and hot-reload: a local file, shipped in a ConfigMap, or an http(s) URL (default: none).")
+
+	// --ready-min-reachable flag
+	workerCmd.PersistentFlags().Float64("ready-min-reachable", 0, "Minimum fraction, in [0, 1], of peers that must have answered within the stats window for a worker to be ready (default: not checked).")
+
+	// --tls flag
+	workerCmd.PersistentFlags().String("tls", "", "Serve and call peers over application TLS using a cert-manager issued workload certificate: 'tls' or 'mtls' (default: plaintext).")
+	if err := workerCmd.RegisterFlagCompletionFunc("tls", tlsCompletion); err != nil {
+		panic(err)
+	}
+
+	// --fault-* knobs
+	workerCmd.PersistentFlags().Float64("fault-error-rate", 0, "Fraction, in [0, 1], of /data requests answered with one of --fault-error-codes.")
+	workerCmd.PersistentFlags().String("fault-error-codes", "", "Comma-separated 4xx/5xx status codes injected errors are drawn from (default: the manager's default).")
+	workerCmd.PersistentFlags().Float64("fault-delay-rate", 0, "Fraction, in [0, 1], of /data requests delayed by --fault-delay (default: the manager's default).")
+	workerCmd.PersistentFlags().Duration("fault-delay", 0, "Latency added to delayed /data requests: the fixed value, or the mean of the distribution.")
+	workerCmd.PersistentFlags().String("fault-delay-distribution", "", "Distribution of injected delays: 'fixed', 'uniform', 'normal' or 'exponential'.")
+	if err := workerCmd.RegisterFlagCompletionFunc("fault-delay-distribution", delayDistributionCompletion); err != nil {
+		panic(err)
+	}
+	workerCmd.PersistentFlags().Duration("fault-delay-spread", 0, "Half-width of the 'uniform' delay distribution, or standard deviation of the 'normal' one.")
+	workerCmd.PersistentFlags().Float64("fault-reset-rate", 0, "Fraction, in [0, 1], of /data requests answered with a TCP reset.")
+	workerCmd.PersistentFlags().Float64("fault-partial-rate", 0, "Fraction, in [0, 1], of /data requests answered with a truncated body.")
+	workerCmd.PersistentFlags().Bool("fault-admin", false, "If set, the workers serve /fault on 127.0.0.1:8087, reachable through kubectl port-forward, to change the faults at runtime.")
+
 	//---------------------------
 	// delete flags
 	//---------------------------
@@ -374,6 +499,182 @@ func ingressModeIsValid(value string) bool {
 	return false
 }
 
+//-----------------------------------------------------------------------------
+// remoteSecretsNamespace
+//-----------------------------------------------------------------------------
+
+// remoteSecretsNamespaceIsValid
+func remoteSecretsNamespaceIsValid(value string) bool {
+	return len(validation.IsDNS1123Label(value)) == 0
+}
+
+//-----------------------------------------------------------------------------
+// unreadyServices
+//-----------------------------------------------------------------------------
+
+// unreadyServicesCompletion
+func unreadyServicesCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"drop", "mark"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// unreadyServicesIsValid
+func unreadyServicesIsValid(value string) bool {
+	return value == "drop" || value == "mark"
+}
+
+//-----------------------------------------------------------------------------
+// protocol
+//-----------------------------------------------------------------------------
+
+// protocolCompletion
+func protocolCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"http", "grpc", "tcp", "websocket"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// protocolIsValid
+func protocolIsValid(value string) bool {
+	return value == "http" || value == "grpc" || value == "tcp" || value == "websocket"
+}
+
+//-----------------------------------------------------------------------------
+// rateMode
+//-----------------------------------------------------------------------------
+
+// rateModeCompletion
+func rateModeCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"per-worker", "per-destination"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// rateModeIsValid
+func rateModeIsValid(value string) bool {
+	return value == "per-worker" || value == "per-destination"
+}
+
+//-----------------------------------------------------------------------------
+// connMode
+//-----------------------------------------------------------------------------
+
+// connModeCompletion
+func connModeCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"pool", "new", "recycle"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// connModeIsValid
+func connModeIsValid(value string) bool {
+	return value == "pool" || value == "new" || value == "recycle"
+}
+
+//-----------------------------------------------------------------------------
+// tls
+//-----------------------------------------------------------------------------
+
+// tlsCompletion
+func tlsCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"tls", "mtls"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// tlsIsValid
+func tlsIsValid(value string) bool {
+	return value == "tls" || value == "mtls"
+}
+
+//-----------------------------------------------------------------------------
+// records
+//-----------------------------------------------------------------------------
+
+// recordsCompletion
+func recordsCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"stdout", "file"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// recordsIsValid
+func recordsIsValid(value string) bool {
+	return value == "stdout" || value == "file"
+}
+
+//-----------------------------------------------------------------------------
+// destinationStrategy
+//-----------------------------------------------------------------------------
+
+// destinationStrategyCompletion
+func destinationStrategyCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"round-robin", "random", "weighted", "zipf", "locality"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// destinationStrategyIsValid
+func destinationStrategyIsValid(value string) bool {
+	switch value {
+	case "round-robin", "random", "weighted", "zipf", "locality":
+		return true
+	}
+	return false
+}
+
+// destinationWeightsIsValid
+func destinationWeightsIsValid(value string) bool {
+	for _, pair := range strings.Split(value, ",") {
+		key, weight, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return false
+		}
+		if n, err := strconv.Atoi(weight); err != nil || n < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
+// profile
+//-----------------------------------------------------------------------------
+
+// profileCompletion
+func profileCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"constant", "ramp", "burst", "sine", "poisson"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// profileIsValid
+func profileIsValid(value string) bool {
+	switch value {
+	case "constant", "ramp", "burst", "sine", "poisson":
+		return true
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+// delayDistribution
+//-----------------------------------------------------------------------------
+
+// delayDistributionCompletion
+func delayDistributionCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"fixed", "uniform", "normal", "exponential"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// delayDistributionIsValid
+func delayDistributionIsValid(value string) bool {
+	switch value {
+	case "fixed", "uniform", "normal", "exponential":
+		return true
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+// faultErrorCodes
+//-----------------------------------------------------------------------------
+
+// faultErrorCodesIsValid
+func faultErrorCodesIsValid(value string) bool {
+	for _, s := range strings.Split(value, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || code < 400 || code > 599 {
+			return false
+		}
+	}
+	return true
+}
+
 //-----------------------------------------------------------------------------
 // validateFlags
 //-----------------------------------------------------------------------------
@@ -437,6 +738,223 @@ func validateFlags(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if cmd.Flags().Changed("remote-secrets-namespace") {
+		value, _ := cmd.Flags().GetString("remote-secrets-namespace")
+		if !remoteSecretsNamespaceIsValid(value) {
+			return errors.New("invalid remote-secrets-namespace (must be a namespace name)")
+		}
+	}
+
+	if cmd.Flags().Changed("unready-services") {
+		value, _ := cmd.Flags().GetString("unready-services")
+		if !unreadyServicesIsValid(value) {
+			return errors.New("invalid unready-services (must be 'drop' or 'mark')")
+		}
+	}
+
+	if cmd.Flags().Changed("protocol") {
+		value, _ := cmd.Flags().GetString("protocol")
+		if !protocolIsValid(value) {
+			return errors.New("invalid protocol (must be 'http', 'grpc', 'tcp' or 'websocket')")
+		}
+	}
+
+	if cmd.Flags().Changed("rate") {
+		value, _ := cmd.Flags().GetFloat64("rate")
+		if value <= 0 {
+			return errors.New("invalid rate (must be greater than 0)")
+		}
+	}
+
+	if cmd.Flags().Changed("rate-mode") {
+		value, _ := cmd.Flags().GetString("rate-mode")
+		if !rateModeIsValid(value) {
+			return errors.New("invalid rate-mode (must be 'per-worker' or 'per-destination')")
+		}
+	}
+
+	if cmd.Flags().Changed("concurrency") {
+		value, _ := cmd.Flags().GetInt("concurrency")
+		if value < 1 {
+			return errors.New("invalid concurrency (must be at least 1)")
+		}
+	}
+
+	if cmd.Flags().Changed("destination-strategy") {
+		value, _ := cmd.Flags().GetString("destination-strategy")
+		if !destinationStrategyIsValid(value) {
+			return errors.New("invalid destination-strategy (must be 'round-robin', 'random', 'weighted', 'zipf' or 'locality')")
+		}
+	}
+
+	if cmd.Flags().Changed("destination-weights") {
+		value, _ := cmd.Flags().GetString("destination-weights")
+		if !destinationWeightsIsValid(value) {
+			return errors.New("invalid destination-weights (must be comma-separated key=weight pairs with non-negative integer weights)")
+		}
+	}
+
+	if cmd.Flags().Changed("destination-zipf-exponent") {
+		value, _ := cmd.Flags().GetFloat64("destination-zipf-exponent")
+		if value <= 0 {
+			return errors.New("invalid destination-zipf-exponent (must be greater than 0)")
+		}
+	}
+
+	if cmd.Flags().Changed("destination-locality-bias") {
+		value, _ := cmd.Flags().GetFloat64("destination-locality-bias")
+		if value < 0 || value > 1 {
+			return errors.New("invalid destination-locality-bias (must be in [0, 1])")
+		}
+	}
+
+	if cmd.Flags().Changed("profile") {
+		value, _ := cmd.Flags().GetString("profile")
+		if !profileIsValid(value) {
+			return errors.New("invalid profile (must be 'constant', 'ramp', 'burst', 'sine' or 'poisson')")
+		}
+	}
+
+	if cmd.Flags().Changed("profile-amplitude") {
+		value, _ := cmd.Flags().GetFloat64("profile-amplitude")
+		if value < 0 || value > 1 {
+			return errors.New("invalid profile-amplitude (must be in [0, 1])")
+		}
+	}
+
+	if cmd.Flags().Changed("profile-jitter") {
+		value, _ := cmd.Flags().GetFloat64("profile-jitter")
+		if value < 0 || value >= 1 {
+			return errors.New("invalid profile-jitter (must be in [0, 1))")
+		}
+	}
+
+	if cmd.Flags().Changed("request-timeout") {
+		value, _ := cmd.Flags().GetDuration("request-timeout")
+		if value < 0 {
+			return errors.New("invalid request-timeout (must not be negative)")
+		}
+	}
+
+	if cmd.Flags().Changed("retries") {
+		value, _ := cmd.Flags().GetInt("retries")
+		if value < 0 {
+			return errors.New("invalid retries (must not be negative)")
+		}
+	}
+
+	if cmd.Flags().Changed("conn-mode") {
+		value, _ := cmd.Flags().GetString("conn-mode")
+		if !connModeIsValid(value) {
+			return errors.New("invalid conn-mode (must be 'pool', 'new' or 'recycle')")
+		}
+	}
+
+	for _, name := range []string{"conn-max-idle", "conn-max-per-host"} {
+		if cmd.Flags().Changed(name) {
+			value, _ := cmd.Flags().GetInt(name)
+			if value < 1 {
+				return fmt.Errorf("invalid %s (must be at least 1)", name)
+			}
+		}
+	}
+
+	if cmd.Flags().Changed("conn-idle-timeout") {
+		value, _ := cmd.Flags().GetDuration("conn-idle-timeout")
+		if value < 0 {
+			return errors.New("invalid conn-idle-timeout (must not be negative)")
+		}
+	}
+
+	if cmd.Flags().Changed("conn-recycle-interval") {
+		value, _ := cmd.Flags().GetDuration("conn-recycle-interval")
+		if value <= 0 {
+			return errors.New("invalid conn-recycle-interval (must be positive)")
+		}
+	}
+
+	if cmd.Flags().Changed("chain-depth") {
+		value, _ := cmd.Flags().GetInt("chain-depth")
+		if value < 0 {
+			return errors.New("invalid chain-depth (must not be negative)")
+		}
+	}
+
+	if cmd.Flags().Changed("chain-fanout") {
+		value, _ := cmd.Flags().GetInt("chain-fanout")
+		if value < 1 {
+			return errors.New("invalid chain-fanout (must be at least 1)")
+		}
+	}
+
+	if cmd.Flags().Changed("tracing-sample-ratio") {
+		value, _ := cmd.Flags().GetFloat64("tracing-sample-ratio")
+		if value < 0 || value > 1 {
+			return errors.New("invalid tracing-sample-ratio (must be in [0, 1])")
+		}
+	}
+
+	if cmd.Flags().Changed("stats-window") {
+		value, _ := cmd.Flags().GetDuration("stats-window")
+		if value <= 0 {
+			return errors.New("invalid stats-window (must be positive)")
+		}
+	}
+
+	if cmd.Flags().Changed("stats-samples") {
+		value, _ := cmd.Flags().GetInt("stats-samples")
+		if value < 1 {
+			return errors.New("invalid stats-samples (must be at least 1)")
+		}
+	}
+
+	if cmd.Flags().Changed("records") {
+		value, _ := cmd.Flags().GetString("records")
+		if !recordsIsValid(value) {
+			return errors.New("invalid records (must be 'stdout' or 'file')")
+		}
+	}
+
+	if cmd.Flags().Changed("ready-min-reachable") {
+		value, _ := cmd.Flags().GetFloat64("ready-min-reachable")
+		if value < 0 || value > 1 {
+			return errors.New("invalid ready-min-reachable (must be in [0, 1])")
+		}
+	}
+
+	if cmd.Flags().Changed("tls") {
+		value, _ := cmd.Flags().GetString("tls")
+		if !tlsIsValid(value) {
+			return errors.New("invalid tls (must be 'tls' or 'mtls')")
+		}
+		if ingressMode, _ := cmd.Flags().GetString("ingress-mode"); ingressMode != "none" {
+			return errors.New("tls cannot be combined with an ingress-mode, whose routes expect plaintext peers")
+		}
+	}
+
+	for _, name := range []string{"fault-error-rate", "fault-delay-rate", "fault-reset-rate", "fault-partial-rate"} {
+		if cmd.Flags().Changed(name) {
+			value, _ := cmd.Flags().GetFloat64(name)
+			if math.IsNaN(value) || value < 0 || value > 1 {
+				return fmt.Errorf("invalid %s (must be in [0, 1])", name)
+			}
+		}
+	}
+
+	if cmd.Flags().Changed("fault-error-codes") {
+		value, _ := cmd.Flags().GetString("fault-error-codes")
+		if !faultErrorCodesIsValid(value) {
+			return errors.New("invalid fault-error-codes (must be comma-separated 4xx or 5xx status codes)")
+		}
+	}
+
+	if cmd.Flags().Changed("fault-delay-distribution") {
+		value, _ := cmd.Flags().GetString("fault-delay-distribution")
+		if !delayDistributionIsValid(value) {
+			return errors.New("invalid fault-delay-distribution (must be 'fixed', 'uniform', 'normal' or 'exponential')")
+		}
+	}
+
 	// Return
 	return nil
 }
@@ -10,14 +10,18 @@ import (
 	"bufio"
 	stdctx "context"
 	"embed"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	// Community
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
 
 	// Local
 	"github.com/h0tbird/k-swarm/cmd/swarmctl/pkg/k8sctx"
@@ -194,6 +198,8 @@ func InstallInformer(cmd *cobra.Command, args []string) error {
 	dataplaneMode, _ := cmd.Flags().GetString("dataplane-mode")
 	waypointName, _ := cmd.Flags().GetString("waypoint-name")
 	ingressMode, _ := cmd.Flags().GetString("ingress-mode")
+	remoteSecretsNamespace, _ := cmd.Flags().GetString("remote-secrets-namespace")
+	unreadyServices, _ := cmd.Flags().GetString("unready-services")
 	dryRun, _ := cmd.Flags().GetBool("dry-run")
 
 	// Set the error prefix
@@ -213,25 +219,35 @@ func InstallInformer(cmd *cobra.Command, args []string) error {
 			fmt.Printf("\n%s\n", name)
 		}
 
+		// Derive cluster name by stripping the kind- prefix (no-op for
+		// non-kind contexts).
+		clusterName := strings.TrimPrefix(name, "kind-")
+
 		// Render the template
 		docs, err := util.RenderTemplate(tmpl, struct {
-			Replicas      int
-			NodeSelector  string
-			Version       string
-			ImageTag      string
-			IstioRevision string
-			DataplaneMode string
-			WaypointName  string
-			IngressMode   string
+			Replicas               int
+			NodeSelector           string
+			Version                string
+			ImageTag               string
+			IstioRevision          string
+			DataplaneMode          string
+			WaypointName           string
+			IngressMode            string
+			ClusterName            string
+			RemoteSecretsNamespace string
+			UnreadyServices        string
 		}{
-			Replicas:      replicas,
-			NodeSelector:  nodeSelector,
-			Version:       cmd.Root().Version,
-			ImageTag:      imageTag,
-			IstioRevision: istioRevision,
-			DataplaneMode: dataplaneMode,
-			WaypointName:  waypointName,
-			IngressMode:   ingressMode,
+			Replicas:               replicas,
+			NodeSelector:           nodeSelector,
+			Version:                cmd.Root().Version,
+			ImageTag:               imageTag,
+			IstioRevision:          istioRevision,
+			DataplaneMode:          dataplaneMode,
+			WaypointName:           waypointName,
+			IngressMode:            ingressMode,
+			ClusterName:            clusterName,
+			RemoteSecretsNamespace: remoteSecretsNamespace,
+			UnreadyServices:        unreadyServices,
 		})
 		if err != nil {
 			return err
@@ -287,6 +303,12 @@ func InstallInformerExample() string {
   # Expose the informer Service via a dedicated Gateway API Gateway+HTTPRoute.
   swarmctl i --context 'kind-pasta-.*' --dataplane-mode ambient --ingress-mode dedicated
 
+  # Also list the swarm Services of the remote clusters in swarm-informer remote secrets.
+  swarmctl i --context 'kind-pasta-.*' --dataplane-mode sidecar --remote-secrets-namespace swarm-informer
+
+  # Keep the services without ready endpoints listed, marked as unready.
+  swarmctl i --context 'kind-pasta-.*' --dataplane-mode sidecar --unready-services mark
+
   # Render the informer manifests to stdout without applying them or contacting the cluster.
   swarmctl i --dry-run | kubectl diff -f -
   `
@@ -375,6 +397,49 @@ func InstallWorker(cmd *cobra.Command, args []string) error {
 	ingressMode, _ := cmd.Flags().GetString("ingress-mode")
 	multiCluster, _ := cmd.Flags().GetBool("multi-cluster")
 	logResponses, _ := cmd.Flags().GetBool("log-responses")
+	protocol, _ := cmd.Flags().GetString("protocol")
+	rate, _ := cmd.Flags().GetFloat64("rate")
+	rateMode, _ := cmd.Flags().GetString("rate-mode")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	destinationStrategy, _ := cmd.Flags().GetString("destination-strategy")
+	destinationWeights, _ := cmd.Flags().GetString("destination-weights")
+	destinationZipfExponent, _ := cmd.Flags().GetFloat64("destination-zipf-exponent")
+	destinationLocalityBias := changedFloat64(cmd, "destination-locality-bias")
+	profile, _ := cmd.Flags().GetString("profile")
+	profilePeriod, _ := cmd.Flags().GetDuration("profile-period")
+	profileBurstDuration, _ := cmd.Flags().GetDuration("profile-burst-duration")
+	profileBurstFactor, _ := cmd.Flags().GetFloat64("profile-burst-factor")
+	profileAmplitude := changedFloat64(cmd, "profile-amplitude")
+	profileJitter, _ := cmd.Flags().GetFloat64("profile-jitter")
+	requestTimeout := changedDuration(cmd, "request-timeout")
+	retries, _ := cmd.Flags().GetInt("retries")
+	retryBackoff, _ := cmd.Flags().GetDuration("retry-backoff")
+	retryMaxBackoff, _ := cmd.Flags().GetDuration("retry-max-backoff")
+	hedgeDelay, _ := cmd.Flags().GetDuration("hedge-delay")
+	connMode, _ := cmd.Flags().GetString("conn-mode")
+	connMaxIdle, _ := cmd.Flags().GetInt("conn-max-idle")
+	connMaxPerHost, _ := cmd.Flags().GetInt("conn-max-per-host")
+	connIdleTimeout := changedDuration(cmd, "conn-idle-timeout")
+	connRecycleInterval, _ := cmd.Flags().GetDuration("conn-recycle-interval")
+	chainDepth, _ := cmd.Flags().GetInt("chain-depth")
+	chainFanout, _ := cmd.Flags().GetInt("chain-fanout")
+	tracingEndpoint, _ := cmd.Flags().GetString("tracing-endpoint")
+	tracingSampleRatio := changedFloat64(cmd, "tracing-sample-ratio")
+	statsWindow, _ := cmd.Flags().GetDuration("stats-window")
+	statsSamples, _ := cmd.Flags().GetInt("stats-samples")
+	readyMinReachable, _ := cmd.Flags().GetFloat64("ready-min-reachable")
+	scenarioSource, _ := cmd.Flags().GetString("scenario")
+	recordsMode, _ := cmd.Flags().GetString("records")
+	tlsMode, _ := cmd.Flags().GetString("tls")
+	faultErrorRate, _ := cmd.Flags().GetFloat64("fault-error-rate")
+	faultErrorCodes, _ := cmd.Flags().GetString("fault-error-codes")
+	faultDelayRate := changedFloat64(cmd, "fault-delay-rate")
+	faultDelay, _ := cmd.Flags().GetDuration("fault-delay")
+	faultDelayDistribution, _ := cmd.Flags().GetString("fault-delay-distribution")
+	faultDelaySpread, _ := cmd.Flags().GetDuration("fault-delay-spread")
+	faultResetRate, _ := cmd.Flags().GetFloat64("fault-reset-rate")
+	faultPartialRate, _ := cmd.Flags().GetFloat64("fault-partial-rate")
+	faultAdmin, _ := cmd.Flags().GetBool("fault-admin")
 	dryRun, _ := cmd.Flags().GetBool("dry-run")
 
 	// Set the error prefix
@@ -386,12 +451,26 @@ func InstallWorker(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Load the traffic scenario, if any
+	scenario, scenarioData, err := workerScenario(scenarioSource)
+	if err != nil {
+		return err
+	}
+
 	// Parse the mode-specific template
 	tmpl, err := util.ParseTemplate(Assets, "worker-"+dataplaneMode)
 	if err != nil {
 		return err
 	}
 
+	// Name the clusters of all contexts, so that every one of them can route
+	// calls to any other cluster
+	var clusters []string
+	for name := range Contexts {
+		clusters = append(clusters, strings.TrimPrefix(name, "kind-"))
+	}
+	slices.Sort(clusters)
+
 	// Loop through all contexts
 	for name, context := range Contexts {
 
@@ -426,33 +505,123 @@ func InstallWorker(cmd *cobra.Command, args []string) error {
 
 			// Render the template
 			docs, err := util.RenderTemplate(tmpl, struct {
-				Replicas      int
-				Namespace     string
-				NodeSelector  string
-				Version       string
-				ImageTag      string
-				IstioRevision string
-				ClusterDomain string
-				ClusterName   string
-				DataplaneMode string
-				WaypointName  string
-				IngressMode   string
-				MultiCluster  bool
-				LogResponses  bool
+				Replicas                int
+				Namespace               string
+				NodeSelector            string
+				Version                 string
+				ImageTag                string
+				IstioRevision           string
+				ClusterDomain           string
+				ClusterName             string
+				Clusters                []string
+				DataplaneMode           string
+				WaypointName            string
+				IngressMode             string
+				MultiCluster            bool
+				LogResponses            bool
+				Protocol                string
+				Rate                    float64
+				RateMode                string
+				Concurrency             int
+				DestinationStrategy     string
+				DestinationWeights      string
+				DestinationZipfExponent float64
+				DestinationLocalityBias *float64
+				Profile                 string
+				ProfilePeriod           time.Duration
+				ProfileBurstDuration    time.Duration
+				ProfileBurstFactor      float64
+				ProfileAmplitude        *float64
+				ProfileJitter           float64
+				RequestTimeout          *time.Duration
+				Retries                 int
+				RetryBackoff            time.Duration
+				RetryMaxBackoff         time.Duration
+				HedgeDelay              time.Duration
+				ConnMode                string
+				ConnMaxIdle             int
+				ConnMaxPerHost          int
+				ConnIdleTimeout         *time.Duration
+				ConnRecycleInterval     time.Duration
+				ChainDepth              int
+				ChainFanout             int
+				TracingEndpoint         string
+				TracingSampleRatio      *float64
+				StatsWindow             time.Duration
+				StatsSamples            int
+				ReadyMinReachable       float64
+				Scenario                string
+				ScenarioData            string
+				Records                 string
+				TLS                     string
+				FaultErrorRate          float64
+				FaultErrorCodes         string
+				FaultDelayRate          *float64
+				FaultDelay              time.Duration
+				FaultDelayDistribution  string
+				FaultDelaySpread        time.Duration
+				FaultResetRate          float64
+				FaultPartialRate        float64
+				FaultAdmin              bool
 			}{
-				Replicas:      replicas,
-				Namespace:     namespace,
-				NodeSelector:  nodeSelector,
-				Version:       cmd.Root().Version,
-				ImageTag:      imageTag,
-				IstioRevision: istioRevision,
-				ClusterDomain: clusterDomain,
-				ClusterName:   clusterName,
-				DataplaneMode: dataplaneMode,
-				WaypointName:  waypointName,
-				IngressMode:   ingressMode,
-				MultiCluster:  multiCluster,
-				LogResponses:  logResponses,
+				Replicas:                replicas,
+				Namespace:               namespace,
+				NodeSelector:            nodeSelector,
+				Version:                 cmd.Root().Version,
+				ImageTag:                imageTag,
+				IstioRevision:           istioRevision,
+				ClusterDomain:           clusterDomain,
+				ClusterName:             clusterName,
+				Clusters:                clusters,
+				DataplaneMode:           dataplaneMode,
+				WaypointName:            waypointName,
+				IngressMode:             ingressMode,
+				MultiCluster:            multiCluster,
+				LogResponses:            logResponses,
+				Protocol:                protocol,
+				Rate:                    rate,
+				RateMode:                rateMode,
+				Concurrency:             concurrency,
+				DestinationStrategy:     destinationStrategy,
+				DestinationWeights:      destinationWeights,
+				DestinationZipfExponent: destinationZipfExponent,
+				DestinationLocalityBias: destinationLocalityBias,
+				Profile:                 profile,
+				ProfilePeriod:           profilePeriod,
+				ProfileBurstDuration:    profileBurstDuration,
+				ProfileBurstFactor:      profileBurstFactor,
+				ProfileAmplitude:        profileAmplitude,
+				ProfileJitter:           profileJitter,
+				RequestTimeout:          requestTimeout,
+				Retries:                 retries,
+				RetryBackoff:            retryBackoff,
+				RetryMaxBackoff:         retryMaxBackoff,
+				HedgeDelay:              hedgeDelay,
+				ConnMode:                connMode,
+				ConnMaxIdle:             connMaxIdle,
+				ConnMaxPerHost:          connMaxPerHost,
+				ConnIdleTimeout:         connIdleTimeout,
+				ConnRecycleInterval:     connRecycleInterval,
+				ChainDepth:              chainDepth,
+				ChainFanout:             chainFanout,
+				TracingEndpoint:         tracingEndpoint,
+				TracingSampleRatio:      tracingSampleRatio,
+				StatsWindow:             statsWindow,
+				StatsSamples:            statsSamples,
+				ReadyMinReachable:       readyMinReachable,
+				Scenario:                scenario,
+				ScenarioData:            scenarioData,
+				Records:                 recordsMode,
+				TLS:                     tlsMode,
+				FaultErrorRate:          faultErrorRate,
+				FaultErrorCodes:         faultErrorCodes,
+				FaultDelayRate:          faultDelayRate,
+				FaultDelay:              faultDelay,
+				FaultDelayDistribution:  faultDelayDistribution,
+				FaultDelaySpread:        faultDelaySpread,
+				FaultResetRate:          faultResetRate,
+				FaultPartialRate:        faultPartialRate,
+				FaultAdmin:              faultAdmin,
 			})
 			if err != nil {
 				return err
@@ -517,11 +686,111 @@ func InstallWorkerExample() string {
   swarmctl w 1:1 --dataplane-mode ambient  --context 'kind-pasta-.*' --multi-cluster
   swarmctl w 1:1 --dataplane-mode sidecar --context 'kind-pasta-.*' --multi-cluster
 
+  # Call peers over gRPC instead of HTTP.
+  swarmctl w 1:1 --dataplane-mode sidecar --protocol grpc
+
+  # Send 5 requests per second to every destination, with at most 50 in flight per pod.
+  swarmctl w 1:1 --dataplane-mode sidecar --rate 5 --rate-mode per-destination --concurrency 50
+
+  # Skew traffic towards a few hot services, with a long tail behind them.
+  swarmctl w 1:1 --dataplane-mode sidecar --rate 50 --destination-strategy zipf --destination-zipf-exponent 1.2
+
+  # Send ten times more requests to namespace swarm-sidecar-n1 than to any other.
+  swarmctl w 1:1 --dataplane-mode sidecar --destination-strategy weighted --destination-weights swarm-sidecar-n1=10
+
+  # Cycle the request rate between 0.2 and 1.8 times --rate over an hour.
+  swarmctl w 1:1 --dataplane-mode sidecar --rate 5 --profile sine --profile-period 1h --profile-amplitude 0.8
+
+  # Burst to 20 times the base rate for 30s every 5 minutes.
+  swarmctl w 1:1 --dataplane-mode sidecar --profile burst --profile-period 5m --profile-burst-duration 30s --profile-burst-factor 20
+
+  # Give every attempt 1s, retry failures up to 3 times and hedge attempts slower than 200ms.
+  swarmctl w 1:1 --dataplane-mode sidecar --request-timeout 1s --retries 3 --hedge-delay 200ms
+
+  # Open a new connection for every request, defeating connection pooling.
+  swarmctl w 1:1 --dataplane-mode sidecar --conn-mode new
+
+  # Keep connections alive but force reconnects to every peer every 30s.
+  swarmctl w 1:1 --dataplane-mode sidecar --conn-mode recycle --conn-recycle-interval 30s
+
+  # Have every request travel through two more peers, each forwarding to two others.
+  swarmctl w 1:1 --dataplane-mode sidecar --chain-depth 2 --chain-fanout 2
+
+  # Export worker spans to an OpenTelemetry collector, sampling 10% of the traces.
+  swarmctl w 1:1 --dataplane-mode sidecar --tracing-endpoint otel-collector.observability:4317 --tracing-sample-ratio 0.1
+
+  # Keep workers out of their Service until half of their peers answer.
+  swarmctl w 1:1 --dataplane-mode sidecar --ready-min-reachable 0.5
+
+  # Drive the traffic from a scenario file, shipped in a ConfigMap the workers reload.
+  swarmctl w 1:1 --dataplane-mode sidecar --rate-mode per-destination --scenario ./scenario.yaml
+
+  # Write a JSON Lines record of every hop to rotated files, to be copied out with kubectl cp.
+  swarmctl w 1:1 --dataplane-mode sidecar --records file
+
+  # Serve and call peers over mTLS with cert-manager issued workload certificates.
+  swarmctl w 1:1 --dataplane-mode sidecar --tls mtls
+
+  # Answer 10% of /data requests with a 503 and add ~100ms of latency to all of them.
+  swarmctl w 1:1 --dataplane-mode sidecar --fault-error-rate 0.1 --fault-delay 100ms --fault-delay-distribution exponential
+
   # Render the worker manifests to stdout without applying them or contacting the cluster.
   swarmctl w 1:1 --dataplane-mode ambient --dry-run | kubectl diff -f -
   `
 }
 
+//-----------------------------------------------------------------------------
+// workerScenario returns the --worker-scenario value for a --scenario flag
+// and, for local files, the scenario to ship in the peer-scenario ConfigMap.
+// The file is shipped base64 encoded as binary data, so that it renders as a
+// single token whatever it contains.
+//-----------------------------------------------------------------------------
+
+func workerScenario(source string) (string, string, error) {
+
+	// None, or served centrally
+	if source == "" || strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return source, "", nil
+	}
+
+	// Read the file
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to read the scenario: %w", err)
+	}
+	if _, err := yaml.YAMLToJSON(data); err != nil {
+		return "", "", fmt.Errorf("invalid scenario %s: %w", source, err)
+	}
+
+	return "/etc/k-swarm/scenario/scenario.yaml", base64.StdEncoding.EncodeToString(data), nil
+}
+
+//-----------------------------------------------------------------------------
+// changedFloat64 returns the value of a float flag only when it was set, so
+// that templates can render an explicit 0 and leave unset flags to the
+// manager's default.
+//-----------------------------------------------------------------------------
+
+func changedFloat64(cmd *cobra.Command, name string) *float64 {
+	if !cmd.Flags().Changed(name) {
+		return nil
+	}
+	value, _ := cmd.Flags().GetFloat64(name)
+	return &value
+}
+
+//-----------------------------------------------------------------------------
+// changedDuration is changedFloat64 for duration flags
+//-----------------------------------------------------------------------------
+
+func changedDuration(cmd *cobra.Command, name string) *time.Duration {
+	if !cmd.Flags().Changed(name) {
+		return nil
+	}
+	value, _ := cmd.Flags().GetDuration(name)
+	return &value
+}
+
 //-----------------------------------------------------------------------------
 // InstallWorkerTelemetry
 //-----------------------------------------------------------------------------
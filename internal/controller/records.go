@@ -0,0 +1,220 @@
+package controller
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	// Community
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ServiceRecordsVersion is the version of the structured service list
+// served by the informer under /v1/services.
+const ServiceRecordsVersion = "v1"
+
+// What the informer does with Services without ready endpoints.
+const (
+	UnreadyDrop = "drop"
+	UnreadyMark = "mark"
+)
+
+// Dataplane modes of a swarm Service, taken from its namespace labels.
+const (
+	DataplaneAmbient = "ambient"
+	DataplaneSidecar = "sidecar"
+	DataplaneNone    = "none"
+)
+
+// ServiceRecord describes a swarm Service as published by the reconciler.
+type ServiceRecord struct {
+	Name           string            `json:"name"`
+	Namespace      string            `json:"namespace"`
+	Cluster        string            `json:"cluster,omitempty"`
+	Ports          []ServicePort     `json:"ports"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	DataplaneMode  string            `json:"dataplaneMode"`
+	ReadyEndpoints int               `json:"readyEndpoints"`
+}
+
+// ClusterRecords is what a reconciler publishes: the records of every swarm
+// Service in one cluster or, with Gone set, the removal of a remote cluster
+// from the federation.
+type ClusterRecords struct {
+	Cluster string
+	Records []ServiceRecord
+	Gone    bool
+}
+
+// ServicePort is an advertised port of a swarm Service.
+type ServicePort struct {
+	Name        string `json:"name"`
+	Port        int32  `json:"port"`
+	Protocol    string `json:"protocol"`
+	AppProtocol string `json:"appProtocol,omitempty"`
+}
+
+//-----------------------------------------------------------------------------
+// Address returns the name.namespace:port address of the named port, or ""
+// if the Service does not advertise it.
+//-----------------------------------------------------------------------------
+
+func (r ServiceRecord) Address(port string) string {
+	for _, p := range r.Ports {
+		if p.Name == port {
+			return r.Name + "." + r.Namespace + ":" + fmt.Sprint(p.Port)
+		}
+	}
+	return ""
+}
+
+//-----------------------------------------------------------------------------
+// PeersOf reduces records to the per-port address lists served to workers
+// that predate the structured records. Those workers cannot target a
+// cluster, so Services of the same name in several clusters share their
+// address, which is listed once; workers reading the records get one
+// destination per cluster instead.
+//-----------------------------------------------------------------------------
+
+func PeersOf(records []ServiceRecord) Peers {
+	peers := Peers{}
+	for _, r := range records {
+		for _, p := range r.Ports {
+			if addr := r.Address(p.Name); !slices.Contains(peers[p.Name], addr) {
+				peers[p.Name] = append(peers[p.Name], addr)
+			}
+		}
+	}
+	return peers
+}
+
+//-----------------------------------------------------------------------------
+// Ready reports whether the Service has ready endpoints. Unready Services
+// are advertised with readyEndpoints set to 0 when they are marked.
+//-----------------------------------------------------------------------------
+
+func (r ServiceRecord) Ready() bool {
+	return r.ReadyEndpoints > 0
+}
+
+//-----------------------------------------------------------------------------
+// Advertised returns the records to advertise: all of them when unready
+// Services are marked, only the ready ones when they are dropped.
+//-----------------------------------------------------------------------------
+
+func Advertised(records []ServiceRecord, unready string) []ServiceRecord {
+	if unready == UnreadyMark {
+		return records
+	}
+	out := make([]ServiceRecord, 0, len(records))
+	for _, r := range records {
+		if r.Ready() {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
+// newServiceRecord builds the record of a Service, nil if it advertises none
+// of the AdvertisedPorts.
+//-----------------------------------------------------------------------------
+
+func (r *ServiceReconciler) newServiceRecord(ctx context.Context, service *corev1.Service) (*ServiceRecord, error) {
+
+	// Advertised ports
+	var ports []ServicePort
+	for _, port := range service.Spec.Ports {
+		if !slices.Contains(AdvertisedPorts, port.Name) {
+			continue
+		}
+		sp := ServicePort{Name: port.Name, Port: port.Port, Protocol: string(port.Protocol)}
+		if port.AppProtocol != nil {
+			sp.AppProtocol = *port.AppProtocol
+		}
+		ports = append(ports, sp)
+	}
+	if len(ports) == 0 {
+		return nil, nil
+	}
+
+	// Dataplane mode
+	mode, err := r.dataplaneMode(ctx, service.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ready endpoints
+	ready, err := r.readyEndpoints(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceRecord{
+		Name:           service.Name,
+		Namespace:      service.Namespace,
+		Cluster:        r.Cluster,
+		Ports:          ports,
+		Labels:         maps.Clone(service.Labels),
+		DataplaneMode:  mode,
+		ReadyEndpoints: ready,
+	}, nil
+}
+
+//-----------------------------------------------------------------------------
+// dataplaneMode tells the Istio dataplane mode of a namespace from its labels
+//-----------------------------------------------------------------------------
+
+func (r *ServiceReconciler) dataplaneMode(ctx context.Context, namespace string) (string, error) {
+
+	var ns corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		return "", err
+	}
+
+	switch labels := ns.Labels; {
+	case labels["istio.io/dataplane-mode"] == "ambient":
+		return DataplaneAmbient, nil
+	case labels["istio-injection"] == "enabled", labels["istio.io/rev"] != "":
+		return DataplaneSidecar, nil
+	}
+	return DataplaneNone, nil
+}
+
+//-----------------------------------------------------------------------------
+// readyEndpoints counts the ready endpoints behind a Service. Dual-stack
+// Services have one slice per address family, so endpoints are counted once
+// per target.
+//-----------------------------------------------------------------------------
+
+func (r *ServiceReconciler) readyEndpoints(ctx context.Context, service *corev1.Service) (int, error) {
+
+	var list discoveryv1.EndpointSliceList
+	if err := r.List(ctx, &list, client.InNamespace(service.Namespace), client.MatchingLabels{discoveryv1.LabelServiceName: service.Name}); err != nil {
+		return 0, err
+	}
+
+	ready := map[string]bool{}
+	for _, slice := range list.Items {
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			key := fmt.Sprint(ep.Addresses)
+			if ep.TargetRef != nil {
+				key = string(ep.TargetRef.UID)
+			}
+			ready[key] = true
+		}
+	}
+	return len(ready), nil
+}
@@ -0,0 +1,352 @@
+package controller
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"maps"
+	"slices"
+	"testing"
+
+	// Community
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+//-----------------------------------------------------------------------------
+// Fixtures
+//-----------------------------------------------------------------------------
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func service(name, ns string, ports ...corev1.ServicePort) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns, Labels: map[string]string{"app": appLabel}},
+		Spec:       corev1.ServiceSpec{Ports: ports},
+	}
+}
+
+func endpointSlice(name, ns, svc string, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: name, Namespace: ns, Labels: map[string]string{discoveryv1.LabelServiceName: svc}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+	}
+}
+
+func endpoint(uid string, ready bool, addresses ...string) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  addresses,
+		Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(ready)},
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", UID: types.UID(uid)},
+	}
+}
+
+var (
+	httpPort = corev1.ServicePort{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}
+	grpcPort = corev1.ServicePort{Name: "grpc", Port: 9090, Protocol: corev1.ProtocolTCP, AppProtocol: ptr.To("grpc")}
+)
+
+//-----------------------------------------------------------------------------
+// newReconciler returns a reconciler of the given objects in cluster east
+// along with the channel it publishes to.
+//-----------------------------------------------------------------------------
+
+func newReconciler(objs ...client.Object) (*ServiceReconciler, chan ClusterRecords) {
+	ch := make(chan ClusterRecords, 1)
+	return &ServiceReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(objs...).Build(),
+		Scheme:   clientgoscheme.Scheme,
+		Cluster:  "east",
+		CommChan: ch,
+	}, ch
+}
+
+//-----------------------------------------------------------------------------
+// TestAddress
+//-----------------------------------------------------------------------------
+
+func TestAddress(t *testing.T) {
+
+	record := ServiceRecord{Name: "peer", Namespace: "n1", Ports: []ServicePort{{Name: "http", Port: 80}, {Name: "grpc", Port: 9090}}}
+
+	tests := []struct {
+		port string
+		want string
+	}{
+		{port: "http", want: "peer.n1:80"},
+		{port: "grpc", want: "peer.n1:9090"},
+		{port: "tcp", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.port, func(t *testing.T) {
+			if got := record.Address(tt.port); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestPeersOf
+//-----------------------------------------------------------------------------
+
+func TestPeersOf(t *testing.T) {
+
+	record := func(name, cluster string, ports ...string) ServiceRecord {
+		r := ServiceRecord{Name: name, Namespace: "n1", Cluster: cluster}
+		for i, p := range ports {
+			r.Ports = append(r.Ports, ServicePort{Name: p, Port: int32(80 + i)})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		records []ServiceRecord
+		want    Peers
+	}{
+		{name: "none", records: nil, want: Peers{}},
+		{name: "by port", records: []ServiceRecord{record("a", "", "http", "grpc"), record("b", "", "http")}, want: Peers{"http": {"a.n1:80", "b.n1:80"}, "grpc": {"a.n1:81"}}},
+		{name: "shared across clusters", records: []ServiceRecord{record("a", "east", "http"), record("a", "west", "http")}, want: Peers{"http": {"a.n1:80"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PeersOf(tt.records); !maps.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestNewServiceRecord
+//-----------------------------------------------------------------------------
+
+func TestNewServiceRecord(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		objs    []client.Object
+		service *corev1.Service
+		want    *ServiceRecord
+	}{
+		{
+			name:    "no advertised port",
+			objs:    []client.Object{namespace("n1", nil)},
+			service: service("peer", "n1", corev1.ServicePort{Name: "metrics", Port: 8080}),
+		},
+		{
+			name:    "plain",
+			objs:    []client.Object{namespace("n1", nil)},
+			service: service("peer", "n1", httpPort, corev1.ServicePort{Name: "metrics", Port: 8080}),
+			want: &ServiceRecord{Name: "peer", Namespace: "n1", Cluster: "east", DataplaneMode: DataplaneNone,
+				Ports: []ServicePort{{Name: "http", Port: 80, Protocol: "TCP"}}},
+		},
+		{
+			name:    "ambient",
+			objs:    []client.Object{namespace("n1", map[string]string{"istio.io/dataplane-mode": "ambient"})},
+			service: service("peer", "n1", grpcPort),
+			want: &ServiceRecord{Name: "peer", Namespace: "n1", Cluster: "east", DataplaneMode: DataplaneAmbient,
+				Ports: []ServicePort{{Name: "grpc", Port: 9090, Protocol: "TCP", AppProtocol: "grpc"}}},
+		},
+		{
+			name:    "sidecar by injection label",
+			objs:    []client.Object{namespace("n1", map[string]string{"istio-injection": "enabled"})},
+			service: service("peer", "n1", httpPort),
+			want: &ServiceRecord{Name: "peer", Namespace: "n1", Cluster: "east", DataplaneMode: DataplaneSidecar,
+				Ports: []ServicePort{{Name: "http", Port: 80, Protocol: "TCP"}}},
+		},
+		{
+			name:    "sidecar by revision",
+			objs:    []client.Object{namespace("n1", map[string]string{"istio.io/rev": "stable"})},
+			service: service("peer", "n1", httpPort),
+			want: &ServiceRecord{Name: "peer", Namespace: "n1", Cluster: "east", DataplaneMode: DataplaneSidecar,
+				Ports: []ServicePort{{Name: "http", Port: 80, Protocol: "TCP"}}},
+		},
+		{
+			name: "ready endpoints",
+			objs: []client.Object{
+				namespace("n1", nil),
+				endpointSlice("peer-v4", "n1", "peer", endpoint("a", true, "10.0.0.1"), endpoint("b", true, "10.0.0.2"), endpoint("c", false, "10.0.0.3")),
+				endpointSlice("peer-v6", "n1", "peer", endpoint("a", true, "fd00::1"), endpoint("b", true, "fd00::2")),
+				endpointSlice("other", "n1", "other", endpoint("d", true, "10.0.0.4")),
+			},
+			service: service("peer", "n1", httpPort),
+			want: &ServiceRecord{Name: "peer", Namespace: "n1", Cluster: "east", DataplaneMode: DataplaneNone, ReadyEndpoints: 2,
+				Ports: []ServicePort{{Name: "http", Port: 80, Protocol: "TCP"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newReconciler(tt.objs...)
+			got, err := r.newServiceRecord(context.Background(), tt.service)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+			got.Labels = nil
+			if got.Name != tt.want.Name || got.Namespace != tt.want.Namespace || got.Cluster != tt.want.Cluster ||
+				got.DataplaneMode != tt.want.DataplaneMode || got.ReadyEndpoints != tt.want.ReadyEndpoints || !slices.Equal(got.Ports, tt.want.Ports) {
+				t.Errorf("got %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+
+	// A namespace that cannot be read is an error
+	r, _ := newReconciler()
+	if _, err := r.newServiceRecord(context.Background(), service("peer", "n1", httpPort)); err == nil {
+		t.Error("got no error for a missing namespace")
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestServiceReconcile checks the records published for every swarm Service
+//-----------------------------------------------------------------------------
+
+func TestServiceReconcile(t *testing.T) {
+
+	other := service("other", "n1", httpPort)
+	other.Labels = map[string]string{"app": "other"}
+
+	tests := []struct {
+		name string
+		objs []client.Object
+		want []string
+	}{
+		{name: "none", objs: nil, want: []string{}},
+		{
+			name: "sorted by namespace and name",
+			objs: []client.Object{
+				namespace("n1", nil), namespace("n2", nil),
+				service("b", "n2", httpPort), service("b", "n1", httpPort), service("a", "n2", grpcPort),
+			},
+			want: []string{"b.n1", "a.n2", "b.n2"},
+		},
+		{
+			name: "not swarm or not advertised",
+			objs: []client.Object{namespace("n1", nil), other, service("quiet", "n1"), service("peer", "n1", httpPort)},
+			want: []string{"peer.n1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ch := newReconciler(tt.objs...)
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{}); err != nil {
+				t.Fatal(err)
+			}
+			update := <-ch
+			if update.Cluster != "east" || update.Gone {
+				t.Errorf("got cluster %q gone %v, want east", update.Cluster, update.Gone)
+			}
+			got := []string{}
+			for _, record := range update.Records {
+				got = append(got, record.Name+"."+record.Namespace)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestAdvertised
+//-----------------------------------------------------------------------------
+
+func TestAdvertised(t *testing.T) {
+
+	records := []ServiceRecord{
+		{Name: "a", ReadyEndpoints: 2},
+		{Name: "b"},
+		{Name: "c", ReadyEndpoints: 1},
+	}
+
+	tests := []struct {
+		name    string
+		unready string
+		want    []string
+	}{
+		{name: UnreadyDrop, unready: UnreadyDrop, want: []string{"a", "c"}},
+		{name: UnreadyMark, unready: UnreadyMark, want: []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, r := range Advertised(records, tt.unready) {
+				got = append(got, r.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestRemoteSecretReconcile checks which remote Secrets start a watch. Only
+// those failing before connecting are covered, since a watch needs a live
+// API server.
+//-----------------------------------------------------------------------------
+
+func TestRemoteSecretReconcile(t *testing.T) {
+
+	secret := func(name, ns string, data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns, Labels: map[string]string{RemoteSecretLabel: "true"}},
+			Data:       data,
+		}
+	}
+
+	tests := []struct {
+		name string
+		objs []client.Object
+		err  bool
+	}{
+		{name: "none", objs: nil},
+		{name: "local cluster ignored", objs: []client.Object{secret("s1", "swarm", map[string][]byte{"east": []byte("garbage")})}},
+		{name: "other namespace ignored", objs: []client.Object{secret("s1", "default", map[string][]byte{"west": []byte("garbage")})}},
+		{name: "bad kubeconfig", objs: []client.Object{secret("s1", "swarm", map[string][]byte{"west": []byte("garbage")})}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RemoteSecretReconciler{
+				Client:    fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(tt.objs...).Build(),
+				Scheme:    clientgoscheme.Scheme,
+				Namespace: "swarm",
+				Cluster:   "east",
+				CommChan:  make(chan ClusterRecords, 1),
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{}); (err != nil) != tt.err {
+				t.Errorf("got error %v, want error %v", err, tt.err)
+			}
+			if len(r.remotes) != 0 {
+				t.Errorf("got %d remote watches, want none", len(r.remotes))
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package controller
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	// Community
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	ctrlcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// RemoteSecretLabel marks the Secrets holding the kubeconfigs of remote
+// clusters, one per data key named after the cluster, like Istio remote
+// secrets.
+const RemoteSecretLabel = "k-swarm/multi-cluster"
+
+// RemoteSecretReconciler reconciles the remote cluster Secrets of one
+// namespace, running a ServiceReconciler against every remote cluster they
+// describe so that its swarm Services join the federated list.
+type RemoteSecretReconciler struct {
+	client.Client
+	Scheme    *runtime.Scheme
+	Namespace string
+	Cluster   string
+	CommChan  chan<- ClusterRecords
+
+	mu      sync.Mutex
+	remotes map[string]*remoteCluster
+	exits   chan event.GenericEvent
+}
+
+// remoteCluster is a running remote cluster watch
+type remoteCluster struct {
+	kubeconfig []byte
+	cancel     context.CancelFunc
+	done       chan struct{}
+	stopping   atomic.Bool
+}
+
+// exited reports whether the watch is over
+func (rc *remoteCluster) exited() bool {
+	select {
+	case <-rc.done:
+		return true
+	default:
+		return false
+	}
+}
+
+//-----------------------------------------------------------------------------
+// SetupWithManager sets up the controller with the Manager.
+//-----------------------------------------------------------------------------
+
+func (r *RemoteSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+
+	// Stop the remote watches along with the manager
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for name := range r.remotes {
+			r.stop(name)
+		}
+		return nil
+	})); err != nil {
+		return err
+	}
+
+	// Define the namespace and label selector as a predicate
+	secretPredicate := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetNamespace() == r.Namespace && obj.GetLabels()[RemoteSecretLabel] == "true"
+	})
+
+	// Create the controller, also reconciling when a remote watch exits
+	r.exits = make(chan event.GenericEvent, 1)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(controllerName+"-remote-secrets").
+		For(&corev1.Secret{}, builder.WithPredicates(secretPredicate)).
+		WatchesRawSource(source.Channel(r.exits, &handler.EnqueueRequestForObject{})).
+		Complete(r)
+}
+
+// Reading the remote Secrets takes a Role in their namespace, which is only
+// known at run time, so it is rendered along with the flag instead of
+// generated here: see swarmctl informer --remote-secrets-namespace.
+
+//-----------------------------------------------------------------------------
+// Reconcile starts, restarts and stops the remote cluster watches to match
+// the remote Secrets. Watches that failed to start or exited on their own
+// are retried with the controller's backoff.
+//-----------------------------------------------------------------------------
+
+func (r *RemoteSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+
+	// Set up logging
+	logger := log.Log.WithName(controllerName).WithValues("secret", req.Name)
+
+	// Get all the remote secrets
+	var secrets corev1.SecretList
+	if err := r.List(ctx, &secrets, client.InNamespace(r.Namespace), client.MatchingLabels{RemoteSecretLabel: "true"}); err != nil {
+		logger.Error(err, "unable to list remote secrets")
+		return ctrl.Result{}, err
+	}
+
+	// Collect the kubeconfigs by cluster, the first secret by name winning
+	slices.SortFunc(secrets.Items, func(a, b corev1.Secret) int { return strings.Compare(a.Name, b.Name) })
+	wanted := map[string][]byte{}
+	for _, secret := range secrets.Items {
+		for cluster, kubeconfig := range secret.Data {
+			switch {
+			case cluster == r.Cluster:
+				logger.Info("ignoring the local cluster in remote secret", "cluster", cluster, "from", secret.Name)
+			case wanted[cluster] != nil:
+				logger.Info("ignoring duplicate remote cluster", "cluster", cluster, "from", secret.Name)
+			default:
+				wanted[cluster] = kubeconfig
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.remotes == nil {
+		r.remotes = map[string]*remoteCluster{}
+	}
+
+	// Stop the clusters that are gone or changed, and drop the watches that
+	// exited, to restart them after a backoff
+	var errs []error
+	for name, remote := range r.remotes {
+		kubeconfig, ok := wanted[name]
+		exited := remote.exited()
+		if ok && bytes.Equal(kubeconfig, remote.kubeconfig) && !exited {
+			continue
+		}
+		if exited {
+			errs = append(errs, fmt.Errorf("remote cluster %s watch exited", name))
+			delete(wanted, name)
+		} else {
+			logger.Info("stopping remote cluster watch", "cluster", name)
+		}
+		r.stop(name)
+		select {
+		case r.CommChan <- ClusterRecords{Cluster: name, Gone: true}:
+		case <-ctx.Done():
+			return ctrl.Result{}, ctx.Err()
+		}
+	}
+
+	// Start the clusters that are new or changed
+	for name, kubeconfig := range wanted {
+		if _, ok := r.remotes[name]; ok {
+			continue
+		}
+		remote, err := r.start(name, kubeconfig)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to watch remote cluster %s: %w", name, err))
+			continue
+		}
+		logger.Info("watching remote cluster", "cluster", name)
+		r.remotes[name] = remote
+	}
+
+	// Requeue with backoff on failures
+	return ctrl.Result{}, errors.Join(errs...)
+}
+
+//-----------------------------------------------------------------------------
+// start runs a ServiceReconciler against a remote cluster, publishing its
+// swarm Services under the cluster name. When either its cache or its
+// controller stops on its own, the watch ends and a reconcile is queued.
+//-----------------------------------------------------------------------------
+
+func (r *RemoteSecretReconciler) start(name string, kubeconfig []byte) (*remoteCluster, error) {
+
+	// Connect to the remote cluster
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := cluster.New(config, func(o *cluster.Options) {
+		o.Scheme = r.Scheme
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the controller, watching the remote swarm services and their
+	// ready endpoints
+	rec := &ServiceReconciler{
+		Client:   remote.GetClient(),
+		Scheme:   r.Scheme,
+		Cluster:  name,
+		CommChan: r.CommChan,
+	}
+	c, err := ctrlcontroller.NewUnmanaged(controllerName+"-remote-"+name, ctrlcontroller.Options{
+		Reconciler:         rec,
+		Logger:             log.Log.WithName(controllerName).WithValues("cluster", name),
+		SkipNameValidation: ptr.To(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Watch(source.Kind(remote.GetCache(), &corev1.Service{},
+		&handler.TypedEnqueueRequestForObject[*corev1.Service]{},
+		predicate.NewTypedPredicateFuncs(func(svc *corev1.Service) bool {
+			return svc.Labels["app"] == appLabel
+		}),
+	)); err != nil {
+		return nil, err
+	}
+	if err := c.Watch(source.Kind(remote.GetCache(), &discoveryv1.EndpointSlice{},
+		handler.TypedEnqueueRequestsFromMapFunc(func(ctx context.Context, slice *discoveryv1.EndpointSlice) []reconcile.Request {
+			return rec.endpointSliceService(ctx, slice)
+		}),
+	)); err != nil {
+		return nil, err
+	}
+
+	// Run the cache and the controller until stopped
+	logger := log.Log.WithName(controllerName).WithValues("cluster", name)
+	ctx, cancel := context.WithCancel(context.Background())
+	rc := &remoteCluster{kubeconfig: kubeconfig, cancel: cancel, done: make(chan struct{})}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		if err := remote.Start(ctx); err != nil {
+			logger.Error(err, "remote cluster cache stopped")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		if err := c.Start(ctx); err != nil {
+			logger.Error(err, "remote cluster controller stopped")
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(rc.done)
+		if !rc.stopping.Load() {
+			logger.Info("remote cluster watch exited")
+			r.exited(name)
+		}
+	}()
+
+	return rc, nil
+}
+
+//-----------------------------------------------------------------------------
+// exited queues a reconcile after a watch exited on its own. Reconciles list
+// every Secret, so one pending reconcile covers any number of exits.
+//-----------------------------------------------------------------------------
+
+func (r *RemoteSecretReconciler) exited(name string) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: r.Namespace}}
+	select {
+	case r.exits <- event.GenericEvent{Object: secret}:
+	default:
+	}
+}
+
+//-----------------------------------------------------------------------------
+// stop stops a remote cluster watch and waits for it to be done, so that no
+// update of it can follow its removal. Called with the lock held.
+//-----------------------------------------------------------------------------
+
+func (r *RemoteSecretReconciler) stop(name string) {
+	remote := r.remotes[name]
+	remote.stopping.Store(true)
+	remote.cancel()
+	<-remote.done
+	delete(r.remotes, name)
+}
@@ -7,30 +7,49 @@ package controller
 import (
 
 	// Stdlib
+	"cmp"
 	"context"
-	"fmt"
+	"slices"
+	"strings"
 
 	// Community
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // ServiceReconciler reconciles a Service object
 type ServiceReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
-	CommChan chan<- []string
+	Cluster  string
+	CommChan chan<- ClusterRecords
 }
 
+// Peers maps an advertised Service port name to the name.namespace:port
+// address of every swarm Service exposing a port with that name. It is the
+// flat form of the records, kept for older workers.
+type Peers map[string][]string
+
 const (
 	controllerName = "k-swarm"
 	appLabel       = "k-swarm"
 )
 
+// AdvertisedPorts are the Service port names published by the reconciler.
+// Each one maps to a protocol the worker knows how to speak.
+var AdvertisedPorts = []string{"http", "grpc", "tcp"}
+
 //-----------------------------------------------------------------------------
 // SetupWithManager sets up the controller with the Manager.
 //-----------------------------------------------------------------------------
@@ -42,17 +61,45 @@ func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return obj.GetLabels()["app"] == appLabel
 	})
 
-	// Create the controller
+	// Reconcile once the cache is synced, so that a cluster without swarm
+	// services publishes its empty list too
+	initial := make(chan event.GenericEvent, 1)
+	initial <- event.GenericEvent{Object: &corev1.Service{}}
+
+	// Create the controller, following the ready endpoints of the services
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(controllerName).
-		For(&corev1.Service{}).
-		WithEventFilter(labelPredicate).
+		For(&corev1.Service{}, builder.WithPredicates(labelPredicate)).
+		Watches(&discoveryv1.EndpointSlice{}, handler.EnqueueRequestsFromMapFunc(r.endpointSliceService)).
+		WatchesRawSource(source.Channel(initial, &handler.EnqueueRequestForObject{})).
 		Complete(r)
 }
 
+//-----------------------------------------------------------------------------
+// endpointSliceService maps an EndpointSlice to its Service, if it is a swarm
+// one.
+//-----------------------------------------------------------------------------
+
+func (r *ServiceReconciler) endpointSliceService(ctx context.Context, slice client.Object) []reconcile.Request {
+
+	name := slice.GetLabels()[discoveryv1.LabelServiceName]
+	if name == "" {
+		return nil
+	}
+
+	key := types.NamespacedName{Namespace: slice.GetNamespace(), Name: name}
+	var service corev1.Service
+	if err := r.Get(ctx, key, &service); err != nil || service.Labels["app"] != appLabel {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: key}}
+}
+
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=core,resources=services/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
 
 //-----------------------------------------------------------------------------
 // Reconcile is part of the main kubernetes reconciliation loop.
@@ -61,7 +108,7 @@ func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 
 	// Set up logging
-	logger := log.Log.WithName(controllerName).WithValues("service", req.Name)
+	logger := log.Log.WithName(controllerName).WithValues("service", req.Name, "cluster", r.Cluster)
 
 	// Get all the swarm services
 	var services corev1.ServiceList
@@ -73,16 +120,26 @@ func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	// Log this reconciliation
 	logger.V(1).Info("reconcile")
 
-	// Send the services to the comm channel
-	var serviceNames []string
-	for _, service := range services.Items {
-		for _, port := range service.Spec.Ports {
-			if port.Name == "http" {
-				serviceNames = append(serviceNames, service.Name+"."+service.Namespace+":"+fmt.Sprint(port.Port))
-			}
+	// Send the service records to the comm channel, in a stable order
+	records := []ServiceRecord{}
+	for i := range services.Items {
+		record, err := r.newServiceRecord(ctx, &services.Items[i])
+		if err != nil {
+			logger.Error(err, "unable to describe service", "name", services.Items[i].Name, "namespace", services.Items[i].Namespace)
+			return ctrl.Result{}, err
 		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+	slices.SortFunc(records, func(a, b ServiceRecord) int {
+		return cmp.Or(strings.Compare(a.Namespace, b.Namespace), strings.Compare(a.Name, b.Name))
+	})
+	select {
+	case r.CommChan <- ClusterRecords{Cluster: r.Cluster, Records: records}:
+	case <-ctx.Done():
+		return ctrl.Result{}, ctx.Err()
 	}
-	r.CommChan <- serviceNames
 
 	// Return on success
 	return ctrl.Result{}, nil
@@ -15,16 +15,80 @@ type FlagPack struct {
 	SyncPeriod           time.Duration
 	ProbeAddr            string
 	EnableHTTP2          bool
+	ShutdownDrainPeriod  time.Duration
 
 	// Informer flags
-	EnableInformer   bool
-	InformerBindAddr string
+	EnableInformer                 bool
+	InformerBindAddr               string
+	InformerRemoteSecretsNamespace string
+	InformerUnreadyServices        string
 
 	// Worker flags
-	EnableWorker          bool
-	WorkerBindAddr        string
-	InformerPollInterval  time.Duration
-	WorkerRequestInterval time.Duration
-	InformerURL           string
-	WorkerLogResponses    bool
+	EnableWorker                  bool
+	WorkerBindAddr                string
+	WorkerMetricsAddr             string
+	WorkerAdminAddr               string
+	WorkerProbeAddr               string
+	WorkerGRPCBindAddr            string
+	WorkerTCPBindAddr             string
+	WorkerTCPPayloadSize          int
+	WorkerTCPFrames               int
+	WorkerStreamIdleTimeout       time.Duration
+	WorkerProtocol                string
+	InformerPollInterval          time.Duration
+	InformerWatch                 bool
+	WorkerRequestInterval         time.Duration
+	WorkerRate                    float64
+	WorkerRateMode                string
+	WorkerConcurrency             int
+	WorkerDestinationStrategy     string
+	WorkerDestinationWeights      map[string]int
+	WorkerDestinationZipfExponent float64
+	WorkerDestinationLocalityBias float64
+	InformerURL                   string
+	WorkerLogResponses            bool
+	WorkerStatsWindow             time.Duration
+	WorkerStatsSamples            int
+	WorkerReadyMinReachable       float64
+	WorkerScenario                string
+	WorkerScenarioReloadInterval  time.Duration
+	WorkerRecords                 string
+	WorkerRecordsMaxSizeMB        int
+	WorkerRecordsMaxFiles         int
+	WorkerChainDepth              int
+	WorkerChainFanout             int
+	WorkerRequestTimeout          time.Duration
+	WorkerRetries                 int
+	WorkerRetryBackoff            time.Duration
+	WorkerRetryMaxBackoff         time.Duration
+	WorkerHedgeDelay              time.Duration
+	WorkerConnMode                string
+	WorkerConnMaxIdle             int
+	WorkerConnMaxPerHost          int
+	WorkerConnIdleTimeout         time.Duration
+	WorkerConnRecycleInterval     time.Duration
+	WorkerTracingEndpoint         string
+	WorkerTracingSampleRatio      float64
+	WorkerTLSCertFile             string
+	WorkerTLSKeyFile              string
+	WorkerTLSCAFile               string
+	WorkerTLSClientAuth           bool
+
+	// Worker traffic profile flags
+	WorkerProfile              string
+	WorkerProfilePeriod        time.Duration
+	WorkerProfileBurstDuration time.Duration
+	WorkerProfileBurstFactor   float64
+	WorkerProfileAmplitude     float64
+	WorkerProfileJitter        float64
+
+	// Worker fault injection flags
+	WorkerFaultErrorRate         float64
+	WorkerFaultErrorCodes        []int
+	WorkerFaultDelayRate         float64
+	WorkerFaultDelay             time.Duration
+	WorkerFaultDelayDistribution string
+	WorkerFaultDelaySpread       time.Duration
+	WorkerFaultResetRate         float64
+	WorkerFaultPartialRate       float64
 }
@@ -0,0 +1,51 @@
+package common
+
+import (
+
+	// Stdlib
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ShutdownTimeout bounds how long Serve waits for in-flight requests once
+// the drain period is over.
+const ShutdownTimeout = 5 * time.Second
+
+// Serve runs srv with serve, typically srv.ListenAndServe or its TLS
+// variant, until ctx is done. It then keeps serving for the drain period, so
+// that clients still routed to it get answers while readiness reports the
+// shutdown, and finally shuts srv down gracefully, letting in-flight
+// requests complete within ShutdownTimeout.
+func Serve(ctx context.Context, srv *http.Server, drain time.Duration, serve func() error) error {
+
+	// Serve until the context is done
+	errc := make(chan error, 1)
+	go func() { errc <- serve() }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Drain
+	timer := time.NewTimer(drain)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case err := <-errc:
+		return err
+	}
+
+	// Shutdown
+	sctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
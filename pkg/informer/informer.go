@@ -5,16 +5,25 @@ import (
 	// Stdlib
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	// Community
-	"github.com/fvbock/endless"
 	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -29,9 +38,8 @@ import (
 //-----------------------------------------------------------------------------
 
 var (
-	scheme      = runtime.NewScheme()
-	log         = ctrl.Log.WithName("informer")
-	serviceList = []string{}
+	scheme = runtime.NewScheme()
+	log    = ctrl.Log.WithName("informer")
 )
 
 //-----------------------------------------------------------------------------
@@ -76,13 +84,32 @@ func Start(ctx context.Context, wg *sync.WaitGroup, flags *common.FlagPack) {
 		metricsServerOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
 	}
 
+	// Give the informer server time to drain on top of the default grace
+	gracefulShutdownTimeout := flags.ShutdownDrainPeriod + common.ShutdownTimeout + 30*time.Second
+
+	// Only cache the Secrets of the remote secrets namespace
+	cacheOptions := cache.Options{}
+	if ns := flags.InformerRemoteSecretsNamespace; ns != "" {
+		cacheOptions.ByObject = map[client.Object]cache.ByObject{
+			&corev1.Secret{}: {Namespaces: map[string]cache.Config{ns: {}}},
+		}
+	}
+
+	// Validate the unready services mode
+	if u := flags.InformerUnreadyServices; u != controller.UnreadyDrop && u != controller.UnreadyMark {
+		log.Error(fmt.Errorf("unknown unready services mode %q", u), "unable to start informer")
+		os.Exit(1)
+	}
+
 	// Initializes a new controller manager
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		Metrics:                metricsServerOptions,
-		HealthProbeBindAddress: flags.ProbeAddr,
-		LeaderElection:         flags.EnableLeaderElection,
-		LeaderElectionID:       "bb4dbf8a.github.com",
+		Scheme:                  scheme,
+		Metrics:                 metricsServerOptions,
+		HealthProbeBindAddress:  flags.ProbeAddr,
+		LeaderElection:          flags.EnableLeaderElection,
+		LeaderElectionID:        "bb4dbf8a.github.com",
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
+		Cache:                   cacheOptions,
 	})
 	if err != nil {
 		log.Error(err, "unable to start manager")
@@ -90,7 +117,8 @@ func Start(ctx context.Context, wg *sync.WaitGroup, flags *common.FlagPack) {
 	}
 
 	// controller --> runnable communication channel
-	commChan := make(chan []string)
+	commChan := make(chan controller.ClusterRecords)
+	cluster := os.Getenv("CLUSTER_NAME")
 
 	//-------------------------
 	// Register the controller
@@ -100,11 +128,26 @@ func Start(ctx context.Context, wg *sync.WaitGroup, flags *common.FlagPack) {
 	if err = (&controller.ServiceReconciler{
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
+		Cluster:  cluster,
 		CommChan: commChan,
 	}).SetupWithManager(mgr); err != nil {
 		log.Error(err, "unable to create controller", "controller", "k-swarm")
 		os.Exit(1)
 	}
+
+	// Register the remote secrets controller
+	if ns := flags.InformerRemoteSecretsNamespace; ns != "" {
+		if err = (&controller.RemoteSecretReconciler{
+			Client:    mgr.GetClient(),
+			Scheme:    mgr.GetScheme(),
+			Namespace: ns,
+			Cluster:   cluster,
+			CommChan:  commChan,
+		}).SetupWithManager(mgr); err != nil {
+			log.Error(err, "unable to create controller", "controller", "k-swarm-remote-secrets")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	//-----------------------
@@ -123,8 +166,19 @@ func Start(ctx context.Context, wg *sync.WaitGroup, flags *common.FlagPack) {
 		os.Exit(1)
 	}
 
-	// Add ready checks
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	// Add ready checks, failing until the first service list is published,
+	// and as soon as shutdown starts so that the informer is taken out of
+	// its Service while it drains. The probe server is the last thing the
+	// manager stops.
+	if err := mgr.AddReadyzCheck("readyz", func(*http.Request) error {
+		if ctx.Err() != nil {
+			return errors.New("shutting down")
+		}
+		if hub.load() == nil {
+			return errors.New("service list not published yet")
+		}
+		return nil
+	}); err != nil {
 		log.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
@@ -145,7 +199,7 @@ func Start(ctx context.Context, wg *sync.WaitGroup, flags *common.FlagPack) {
 //-----------------------------------------------------------------------------
 
 type Informer struct {
-	commChan chan []string
+	commChan chan controller.ClusterRecords
 	flags    *common.FlagPack
 }
 
@@ -153,7 +207,7 @@ type Informer struct {
 // newInformer returns a new informer runnable
 //-----------------------------------------------------------------------------
 
-func newInformer(commChan chan []string, flags *common.FlagPack) Informer {
+func newInformer(commChan chan controller.ClusterRecords, flags *common.FlagPack) Informer {
 	return Informer{
 		commChan: commChan,
 		flags:    flags,
@@ -168,12 +222,21 @@ func (i Informer) Start(ctx context.Context) error {
 
 	log.Info("starting runnable")
 
-	// Retrieve the services from the comm channel
+	// Retrieve the services from the comm channel, merging the clusters
 	go func() {
+		clusters := map[string][]controller.ServiceRecord{}
 		for {
 			select {
-			case serviceList = <-i.commChan:
-				log.Info("new update", "services", serviceList)
+			case update := <-i.commChan:
+				if update.Gone {
+					delete(clusters, update.Cluster)
+				} else {
+					clusters[update.Cluster] = update.Records
+				}
+				records := controller.Advertised(federate(clusters), i.flags.InformerUnreadyServices)
+				if state, changed := hub.update(records); changed {
+					log.Info("new update", "generation", state.generation, "cluster", update.Cluster, "clusters", len(clusters), "records", len(state.records), "services", state.peers)
+				}
 			case <-ctx.Done():
 				log.Info("stopping informer runnable")
 				return
@@ -191,9 +254,16 @@ func (i Informer) Start(ctx context.Context) error {
 
 	// Routes
 	router.GET("/services", getServices)
-
-	// Start the server
-	if err := endless.ListenAndServe(i.flags.InformerBindAddr, router); err != nil {
+	router.GET("/v1/services", getServiceRecords)
+	router.GET("/v1/services/watch", watchServiceRecords(ctx))
+
+	// Start the server, draining it once the context is done
+	srv := &http.Server{
+		Addr:              i.flags.InformerBindAddr,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := common.Serve(ctx, srv, i.flags.ShutdownDrainPeriod, srv.ListenAndServe); err != nil {
 		log.Error(err, "unable to start informer server")
 		return err
 	}
@@ -203,11 +273,86 @@ func (i Informer) Start(ctx context.Context) error {
 }
 
 //-----------------------------------------------------------------------------
-// getServices
+// getServices returns the http peers under "services", as older workers
+// expect, and every advertised port name under "ports".
 //-----------------------------------------------------------------------------
 
 func getServices(c *gin.Context) {
+	state := hub.load()
+	if unpublished(c, state) || notModified(c, state) {
+		return
+	}
 	c.JSON(200, gin.H{
-		"services": serviceList,
+		"services": state.peers["http"],
+		"ports":    state.peers,
 	})
 }
+
+//-----------------------------------------------------------------------------
+// getServiceRecords returns a structured record of every swarm Service:
+// name, namespace, cluster, ports with their protocol, labels, dataplane
+// mode and number of ready endpoints, along with their generation.
+//-----------------------------------------------------------------------------
+
+func getServiceRecords(c *gin.Context) {
+	state := hub.load()
+	if unpublished(c, state) || notModified(c, state) {
+		return
+	}
+	c.JSON(200, serviceRecords(state))
+}
+
+//-----------------------------------------------------------------------------
+// unpublished answers 503 and returns true while there is no state yet, so
+// that workers keep their list instead of taking an empty one.
+//-----------------------------------------------------------------------------
+
+func unpublished(c *gin.Context, state *serviceState) bool {
+	if state != nil {
+		return false
+	}
+	c.Header("Retry-After", "1")
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "service list not published yet"})
+	return true
+}
+
+//-----------------------------------------------------------------------------
+// notModified sets the ETag of the state and, when the If-None-Match header
+// of the request already names it, answers 304 and returns true.
+//-----------------------------------------------------------------------------
+
+func notModified(c *gin.Context, state *serviceState) bool {
+	c.Header("ETag", state.etag)
+	for tag := range strings.SplitSeq(c.GetHeader("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == state.etag || tag == "*" {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+// serviceRecords is the versioned document served for a state
+//-----------------------------------------------------------------------------
+
+func serviceRecords(state *serviceState) gin.H {
+	return gin.H{
+		"apiVersion": controller.ServiceRecordsVersion,
+		"generation": state.generation,
+		"services":   state.records,
+	}
+}
+
+//-----------------------------------------------------------------------------
+// federate merges the records of every cluster, ordered by cluster
+//-----------------------------------------------------------------------------
+
+func federate(clusters map[string][]controller.ServiceRecord) []controller.ServiceRecord {
+	records := []controller.ServiceRecord{}
+	for _, name := range slices.Sorted(maps.Keys(clusters)) {
+		records = append(records, clusters[name]...)
+	}
+	return records
+}
@@ -0,0 +1,161 @@
+package informer
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	// Community
+	"github.com/gin-gonic/gin"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/internal/controller"
+)
+
+//-----------------------------------------------------------------------------
+// TestNotModified
+//-----------------------------------------------------------------------------
+
+func TestNotModified(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	state := newServiceState([]controller.ServiceRecord{{Name: "peer", Namespace: "n1"}}, 3)
+	other := newServiceState([]controller.ServiceRecord{{Name: "peer", Namespace: "n2"}}, 3)
+	if state.etag == other.etag {
+		t.Fatalf("different records share the ETag %s", state.etag)
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		status      int
+	}{
+		{name: "no header", ifNoneMatch: "", status: http.StatusOK},
+		{name: "current", ifNoneMatch: state.etag, status: http.StatusNotModified},
+		{name: "weak", ifNoneMatch: "W/" + state.etag, status: http.StatusNotModified},
+		{name: "list", ifNoneMatch: other.etag + ", " + state.etag, status: http.StatusNotModified},
+		{name: "wildcard", ifNoneMatch: "*", status: http.StatusNotModified},
+		{name: "stale", ifNoneMatch: other.etag, status: http.StatusOK},
+		{name: "unquoted", ifNoneMatch: state.etag[1 : len(state.etag)-1], status: http.StatusOK},
+	}
+
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		if notModified(c, state) {
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("ETag"); got != state.etag {
+				t.Errorf("got ETag %q, want %q", got, state.etag)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestServiceHubUpdate publishes a sequence of record sets and checks the
+// generations and the notifications.
+//-----------------------------------------------------------------------------
+
+func TestServiceHubUpdate(t *testing.T) {
+
+	h := newServiceHub()
+	changes, unsubscribe := h.subscribe()
+	defer unsubscribe()
+	n1 := []controller.ServiceRecord{{Name: "peer", Namespace: "n1"}}
+	n2 := []controller.ServiceRecord{{Name: "peer", Namespace: "n2"}}
+
+	tests := []struct {
+		name       string
+		records    []controller.ServiceRecord
+		changed    bool
+		generation uint64
+	}{
+		{name: "first", records: n1, changed: true, generation: 1},
+		{name: "same", records: n1, changed: false, generation: 1},
+		{name: "changed", records: n2, changed: true, generation: 2},
+		{name: "back", records: n1, changed: true, generation: 3},
+		{name: "empty", records: []controller.ServiceRecord{}, changed: true, generation: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, changed := h.update(tt.records)
+			if changed != tt.changed || state.generation != tt.generation {
+				t.Errorf("got changed %v generation %d, want %v and %d", changed, state.generation, tt.changed, tt.generation)
+			}
+			if h.load() != state {
+				t.Error("the state in effect is not the current one")
+			}
+			select {
+			case <-changes:
+				if !tt.changed {
+					t.Error("notified without a change")
+				}
+			default:
+				if tt.changed {
+					t.Error("not notified of the change")
+				}
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestFederate
+//-----------------------------------------------------------------------------
+
+func TestFederate(t *testing.T) {
+
+	record := func(cluster, namespace string) controller.ServiceRecord {
+		return controller.ServiceRecord{Name: "peer", Namespace: namespace, Cluster: cluster}
+	}
+
+	tests := []struct {
+		name     string
+		clusters map[string][]controller.ServiceRecord
+		want     []controller.ServiceRecord
+	}{
+		{name: "none", clusters: nil, want: []controller.ServiceRecord{}},
+		{name: "empty cluster", clusters: map[string][]controller.ServiceRecord{"east": nil}, want: []controller.ServiceRecord{}},
+		{
+			name: "ordered by cluster",
+			clusters: map[string][]controller.ServiceRecord{
+				"west": {record("west", "n1")},
+				"east": {record("east", "n1"), record("east", "n2")},
+			},
+			want: []controller.ServiceRecord{record("east", "n1"), record("east", "n2"), record("west", "n1")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := federate(tt.clusters)
+			if got == nil || !slices.EqualFunc(got, tt.want, func(a, b controller.ServiceRecord) bool {
+				return a.Cluster == b.Cluster && a.Namespace == b.Namespace
+			}) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package informer
+
+import (
+
+	// Stdlib
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	// Community
+	"github.com/gin-gonic/gin"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/internal/controller"
+)
+
+//-----------------------------------------------------------------------------
+// Service watch
+//
+// GET /v1/services/watch streams the service records as Server-Sent Events:
+// a "services" event carrying the same document as GET /v1/services right
+// away, then another one every time the reconciler publishes an update.
+// Until the reconciler first publishes, the stream only carries heartbeats,
+// so that workers keep their list instead of taking an empty one. A
+// comment line is sent every watchHeartbeat so that idle streams survive
+// proxies and workers can tell a silent informer from a dead connection.
+// Streams end when the informer starts shutting down; workers reconnect and
+// poll in the meantime.
+//-----------------------------------------------------------------------------
+
+const watchHeartbeat = 15 * time.Second
+
+var hub = newServiceHub()
+
+//-----------------------------------------------------------------------------
+// serviceState is the last update of the reconciler, along with the flat
+// per-port lists derived from it for older workers. It is replaced whole on
+// every change and never modified in place.
+//
+// The generation counts the changes of the service set seen by this informer
+// since it started, so it only orders the states of one replica. The ETag
+// pairs it with a digest of the records, so that a worker switching replicas
+// never mistakes a different set for the one it has.
+//-----------------------------------------------------------------------------
+
+type serviceState struct {
+	records    []controller.ServiceRecord
+	peers      controller.Peers
+	generation uint64
+	encoded    []byte
+	etag       string
+}
+
+func newServiceState(records []controller.ServiceRecord, generation uint64) *serviceState {
+	encoded, err := json.Marshal(records)
+	if err != nil {
+		log.Error(err, "unable to encode service records")
+	}
+	digest := fnv.New64a()
+	digest.Write(encoded)
+	return &serviceState{
+		records:    records,
+		peers:      controller.PeersOf(records),
+		generation: generation,
+		encoded:    encoded,
+		etag:       fmt.Sprintf(`"%d-%x"`, generation, digest.Sum64()),
+	}
+}
+
+//-----------------------------------------------------------------------------
+// serviceHub holds the current state and notifies the watchers of every
+// change. Notifications are coalesced, so watchers send the latest state
+// once notified. There is no state until the reconciler first publishes.
+//-----------------------------------------------------------------------------
+
+type serviceHub struct {
+	current atomic.Pointer[serviceState]
+	mu      sync.Mutex
+	subs    map[chan struct{}]struct{}
+}
+
+func newServiceHub() *serviceHub {
+	return &serviceHub{subs: map[chan struct{}]struct{}{}}
+}
+
+func (h *serviceHub) load() *serviceState {
+	return h.current.Load()
+}
+
+//-----------------------------------------------------------------------------
+// update publishes the records under the next generation, unless they are
+// the current ones, and returns the state in effect and whether it changed.
+// The first update is always published, as generation 1.
+//-----------------------------------------------------------------------------
+
+func (h *serviceHub) update(records []controller.ServiceRecord) (*serviceState, bool) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Skip reconciles that changed nothing
+	prev := h.current.Load()
+	if prev == nil {
+		prev = &serviceState{}
+	} else if state := newServiceState(records, prev.generation); bytes.Equal(state.encoded, prev.encoded) {
+		return prev, false
+	}
+	state := newServiceState(records, prev.generation+1)
+
+	// Publish and notify
+	h.current.Store(state)
+	for ch := range h.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return state, true
+}
+
+//-----------------------------------------------------------------------------
+// subscribe returns a channel notified after every update and a function
+// that unsubscribes it.
+//-----------------------------------------------------------------------------
+
+func (h *serviceHub) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs, ch)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// watchServiceRecords streams the service records until the worker goes away
+// or the context is done.
+//-----------------------------------------------------------------------------
+
+func watchServiceRecords(ctx context.Context) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		// Subscribe before the first event so that no update is missed
+		changes, unsubscribe := hub.subscribe()
+		defer unsubscribe()
+		heartbeat := time.NewTicker(watchHeartbeat)
+		defer heartbeat.Stop()
+
+		// Send the current state, once there is one, then every update
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		send := func() {
+			if state := hub.load(); state != nil {
+				c.SSEvent("services", serviceRecords(state))
+			}
+			c.Writer.Flush()
+		}
+		send()
+		for {
+			select {
+			case <-changes:
+				send()
+			case <-heartbeat.C:
+				fmt.Fprint(c.Writer, ": heartbeat\n\n")
+				c.Writer.Flush()
+			case <-c.Request.Context().Done():
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package worker
+
+import (
+
+	// Stdlib
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	// Community
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Call chains
+//
+// With --worker-chain-depth set, the worker asks the peers it calls to
+// forward the request. The remaining depth and the fan-out travel in the
+// X-K-Swarm-Depth and X-K-Swarm-Fanout headers: a peer receiving a depth
+// above zero calls fanout random peers of its own with the depth decremented,
+// and nests their answers under "next" in its /data response. The originating
+// worker gets the whole call tree back, logs it and exports every edge.
+//-----------------------------------------------------------------------------
+
+const (
+	chainDepthHeader  = "X-K-Swarm-Depth"
+	chainFanoutHeader = "X-K-Swarm-Fanout"
+
+	// maxChainCalls bounds the number of calls a single chain may trigger,
+	// since the tree grows as fanout^depth.
+	maxChainCalls = 1000
+)
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+var (
+	chainDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "chain_duration_seconds",
+		Help:      "End-to-end latency of call chains started by the worker, by the depth they reached.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"depth"})
+
+	chainEdges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "chain_edges_total",
+		Help:      "Number of calls made between peers inside call chains started by the worker.",
+	}, hopLabels)
+
+	chainEdgeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "chain_edge_duration_seconds",
+		Help:      "Latency of calls made between peers inside call chains started by the worker.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, hopLabels)
+)
+
+func init() {
+	registry.MustRegister(chainDuration, chainEdges, chainEdgeDuration)
+}
+
+//-----------------------------------------------------------------------------
+// chainNode is one peer in a call tree: the /data response of that peer,
+// plus how its caller saw the call. The root node's call fields are empty;
+// they live in the hop itself.
+//-----------------------------------------------------------------------------
+
+type chainNode struct {
+	peerInfo
+	Service    string      `json:"service,omitempty"`
+	Status     int         `json:"status,omitempty"`
+	DurationMs float64     `json:"duration_ms,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Identity   string      `json:"identity,omitempty"`
+	Phases     *phases     `json:"phases_ms,omitempty"`
+	Next       []chainNode `json:"next,omitempty"`
+}
+
+//-----------------------------------------------------------------------------
+// validateChain checks that a chain stays within maxChainCalls
+//-----------------------------------------------------------------------------
+
+func validateChain(depth, fanout int) error {
+
+	if depth < 0 || fanout < 1 {
+		return fmt.Errorf("chain depth must not be negative and fanout must be at least 1, got %d and %d", depth, fanout)
+	}
+
+	calls, width := 0, 1
+	for range depth {
+		width *= fanout
+		calls += width
+		if calls > maxChainCalls {
+			return fmt.Errorf("a chain of depth %d and fanout %d makes more than %d calls", depth, fanout, maxChainCalls)
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// getData answers /data, forwarding the request first when asked to
+//-----------------------------------------------------------------------------
+
+func getData(flags *common.FlagPack) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		// Scenarios may send payloads
+		if _, err := io.Copy(io.Discard, c.Request.Body); err != nil {
+			log.V(1).Info("failed to read request body", "error", err.Error())
+		}
+
+		// Plain hop
+		depth, _ := strconv.Atoi(c.GetHeader(chainDepthHeader))
+		fanout, _ := strconv.Atoi(c.GetHeader(chainFanoutHeader))
+		if depth <= 0 {
+			c.JSON(http.StatusOK, localPeer())
+			return
+		}
+
+		// Refuse to amplify beyond the limit
+		if err := validateChain(depth, fanout); err != nil {
+			log.V(1).Info("not forwarding chain", "error", err.Error())
+			c.JSON(http.StatusOK, localPeer())
+			return
+		}
+
+		// Forward and nest the answers
+		c.JSON(http.StatusOK, chainNode{
+			peerInfo: localPeer(),
+			Next:     forward(c.Request.Context(), flags, depth-1, fanout),
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// forward calls fanout random peers in parallel, each within the request
+// timeout. Calls that time out are nested as failed nodes. Chains are HTTP
+// only, so a worker whose own traffic targets another port does not forward.
+//-----------------------------------------------------------------------------
+
+func forward(ctx context.Context, flags *common.FlagPack, depth, fanout int) []chainNode {
+
+	// Pick the peers
+	if protocols[flags.WorkerProtocol].port != "http" {
+		return nil
+	}
+	services := peers.snapshot()
+	picked := make([]string, 0, fanout)
+	for _, i := range rand.Perm(len(services)) {
+		if len(picked) == fanout {
+			break
+		}
+		picked = append(picked, services[i])
+	}
+
+	// Call them
+	nodes := make([]chainNode, len(picked))
+	var wg sync.WaitGroup
+	for i, service := range picked {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fctx := ctx
+			if timeout := requestTimeout(flags, service); timeout > 0 {
+				var cancel context.CancelFunc
+				fctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			node, status, body, duration, err := fetchData(fctx, service, depth, fanout)
+			switch {
+			case err != nil:
+				node.Error = err.Error()
+			case body != nil:
+				node.Error = "unexpected response body"
+			}
+			node.Service = service
+			node.Status = status
+			node.DurationMs = float64(duration) / float64(time.Millisecond)
+			nodes[i] = node
+		}()
+	}
+	wg.Wait()
+
+	return nodes
+}
+
+//-----------------------------------------------------------------------------
+// fetchData calls a peer's /data endpoint, or whatever the scenario says,
+// asking it to forward the request depth more times. body is only returned
+// when it could not be parsed.
+//-----------------------------------------------------------------------------
+
+func fetchData(ctx context.Context, service string, depth, fanout int) (node chainNode, status int, body []byte, duration time.Duration, err error) {
+
+	// Build the request as the scenario describes it
+	t := scenarios.load().traffic(service)
+	method, urlPath := cmp.Or(t.Method, http.MethodGet), cmp.Or(t.Path, "/data")
+	var payload io.Reader
+	if t.PayloadBytes > 0 {
+		payload = bytes.NewReader(bytes.Repeat([]byte("x"), t.PayloadBytes))
+	}
+	addr, cluster := splitDestination(service)
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s://%s%s", scheme("http"), addr, urlPath), payload)
+	if err != nil {
+		return node, 0, nil, 0, err
+	}
+	if cluster != "" {
+		req.Header.Set(clusterHeader, cluster)
+	}
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	if n := attemptFrom(ctx); n > 0 {
+		req.Header.Set(attemptHeader, strconv.Itoa(n))
+	}
+	if depth > 0 {
+		req.Header.Set(chainDepthHeader, strconv.Itoa(depth))
+		req.Header.Set(chainFanoutHeader, strconv.Itoa(fanout))
+	}
+
+	// Send the request, timing its phases
+	var timer phaseTimer
+	req = req.WithContext(timer.trace(ctx))
+	defer func() {
+		p := timer.finish()
+		node.Phases = &p
+	}()
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	duration = time.Since(start)
+	if err != nil {
+		return node, 0, nil, duration, err
+	}
+
+	// Read the body
+	body, err = io.ReadAll(resp.Body)
+	duration = time.Since(start)
+	if cerr := resp.Body.Close(); cerr != nil {
+		log.Error(cerr, "failed to close response body", "service", service)
+	}
+	if err != nil {
+		return node, resp.StatusCode, nil, duration, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Parse the peer identity and its subtree, keeping the one its
+	// certificate asserts
+	if err := json.Unmarshal(body, &node); err != nil {
+		node.Identity = peerIdentity(resp.TLS)
+		return node, resp.StatusCode, body, duration, nil
+	}
+	node.Identity = peerIdentity(resp.TLS)
+	return node, resp.StatusCode, nil, duration, nil
+}
+
+//-----------------------------------------------------------------------------
+// observeChain records a call tree started by this worker: its end-to-end
+// latency by the depth it reached, and every edge below the first hop.
+//-----------------------------------------------------------------------------
+
+func observeChain(root *chainNode, duration time.Duration) {
+
+	// Walk the tree
+	var walk func(from chainNode, level int) int
+	walk = func(from chainNode, level int) int {
+		reached := level
+		for _, to := range from.Next {
+			var err error
+			if to.Error != "" {
+				err = errors.New(to.Error)
+			}
+			labels := peerLabels(from.peerInfo, to.peerInfo, to.Service)
+			labels["status_class"] = statusClass(to.Status, err)
+			chainEdges.With(labels).Inc()
+			chainEdgeDuration.With(labels).Observe(to.DurationMs / 1000)
+			reached = max(reached, walk(to, level+1))
+		}
+		return reached
+	}
+
+	// Record the end-to-end latency
+	depth := walk(*root, 1)
+	chainDuration.WithLabelValues(strconv.Itoa(depth)).Observe(duration.Seconds())
+}
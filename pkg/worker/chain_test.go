@@ -0,0 +1,168 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	// Community
+	"github.com/gin-gonic/gin"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// TestValidateChain
+//-----------------------------------------------------------------------------
+
+func TestValidateChain(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		depth, fanout int
+		err           bool
+	}{
+		{name: "no chain", depth: 0, fanout: 1},
+		{name: "deep and narrow", depth: 8, fanout: 2},
+		{name: "shallow and wide", depth: 2, fanout: 31},
+		{name: "negative depth", depth: -1, fanout: 1, err: true},
+		{name: "no fanout", depth: 1, fanout: 0, err: true},
+		{name: "too deep", depth: 9, fanout: 2, err: true},
+		{name: "too wide", depth: 3, fanout: 10, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateChain(tt.depth, tt.fanout); (err != nil) != tt.err {
+				t.Errorf("got error %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestChainForward runs two peers that forward to each other and checks the
+// shape of the call tree they return.
+//-----------------------------------------------------------------------------
+
+func TestChainForward(t *testing.T) {
+
+	// Two peers serving /data
+	gin.SetMode(gin.TestMode)
+	flags := &common.FlagPack{WorkerProtocol: "http"}
+	router := gin.New()
+	router.GET("/data", getData(flags))
+	var services []string
+	for range 2 {
+		srv := httptest.NewServer(router)
+		defer srv.Close()
+		services = append(services, strings.TrimPrefix(srv.URL, "http://"))
+	}
+	prev := peers.snapshot()
+	peers.update(services, nil)
+	defer peers.update(prev, nil)
+
+	tests := []struct {
+		name          string
+		depth, fanout int
+		widths        []int
+	}{
+		{name: "plain", depth: 0, fanout: 0, widths: nil},
+		{name: "one hop", depth: 1, fanout: 1, widths: []int{1}},
+		{name: "fan out", depth: 1, fanout: 2, widths: []int{2}},
+		{name: "fanout capped by peers", depth: 1, fanout: 5, widths: []int{2}},
+		{name: "two hops", depth: 2, fanout: 2, widths: []int{2, 4}},
+		{name: "beyond the limit", depth: 10, fanout: 10, widths: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Start a chain at the first peer
+			req, err := http.NewRequest(http.MethodGet, "http://"+services[0]+"/data", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(chainDepthHeader, strconv.Itoa(tt.depth))
+			req.Header.Set(chainFanoutHeader, strconv.Itoa(tt.fanout))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			var root chainNode
+			if err := json.NewDecoder(resp.Body).Decode(&root); err != nil {
+				t.Fatal(err)
+			}
+
+			// Count the nodes at every level, all of which must have answered
+			var widths []int
+			level := root.Next
+			for len(level) > 0 {
+				widths = append(widths, len(level))
+				var next []chainNode
+				for _, node := range level {
+					if node.Error != "" || node.Status != http.StatusOK {
+						t.Errorf("node %s failed with status %d: %s", node.Service, node.Status, node.Error)
+					}
+					next = append(next, node.Next...)
+				}
+				level = next
+			}
+			if len(widths) != len(tt.widths) {
+				t.Fatalf("got level widths %v, want %v", widths, tt.widths)
+			}
+			for i := range widths {
+				if widths[i] != tt.widths[i] {
+					t.Fatalf("got level widths %v, want %v", widths, tt.widths)
+				}
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestChainForwardTimeout forwards to a peer that does not answer in time and
+// checks that the call is nested as a failed node.
+//-----------------------------------------------------------------------------
+
+func TestChainForwardTimeout(t *testing.T) {
+
+	// A peer slower than the request timeout
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	service := strings.TrimPrefix(srv.URL, "http://")
+	prev := peers.snapshot()
+	peers.update([]string{service}, nil)
+	defer peers.update(prev, nil)
+
+	// Forward to it
+	start := time.Now()
+	nodes := forward(context.Background(), &common.FlagPack{WorkerProtocol: "http", WorkerRequestTimeout: 50 * time.Millisecond}, 0, 1)
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("forward took %s, want it bounded by the request timeout", elapsed)
+	}
+	if len(nodes) != 1 {
+		t.Fatalf("got %d nodes, want 1", len(nodes))
+	}
+	if node := nodes[0]; node.Service != service || node.Status != 0 || !strings.Contains(node.Error, context.DeadlineExceeded.Error()) {
+		t.Errorf("got node %s with status %d and error %q, want it timed out", node.Service, node.Status, node.Error)
+	}
+}
@@ -0,0 +1,233 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	// Community
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Connection modes
+//-----------------------------------------------------------------------------
+
+const (
+
+	// ConnModePool keeps connections alive and reuses them, within the
+	// configured idle and per-host limits.
+	ConnModePool = "pool"
+
+	// ConnModeNew opens a new connection for every request.
+	ConnModeNew = "new"
+
+	// ConnModeRecycle pools connections but replaces the whole pool every
+	// --worker-conn-recycle-interval, forcing periodic reconnects.
+	ConnModeRecycle = "recycle"
+)
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+var (
+	connsOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "http_connections_open",
+		Help:      "Number of HTTP client connections currently open by the worker.",
+	})
+
+	connsAcquired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "http_connections_acquired_total",
+		Help:      "Number of connections handed to HTTP requests by the worker, by whether they were reused.",
+	}, []string{"reused"})
+
+	connDialDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "http_connection_dial_duration_seconds",
+		Help:      "Time taken by the worker to establish new HTTP client connections.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	})
+
+	connsRecycled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "http_connection_pool_recycles_total",
+		Help:      "Number of times the worker replaced its HTTP connection pool in recycle mode.",
+	})
+)
+
+func init() {
+	registry.MustRegister(connsOpen, connsAcquired, connDialDuration, connsRecycled)
+}
+
+//-----------------------------------------------------------------------------
+// httpClient is the client used for peer calls. It is built by setupConns,
+// and defaults to a pooled, traced client until then.
+//-----------------------------------------------------------------------------
+
+var httpClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+//-----------------------------------------------------------------------------
+// setupConns builds httpClient for the configured connection mode. The
+// recycler, if any, runs until the context is done.
+//-----------------------------------------------------------------------------
+
+func setupConns(ctx context.Context, flags *common.FlagPack) error {
+
+	// Validate
+	switch flags.WorkerConnMode {
+	case ConnModePool, ConnModeNew:
+	case ConnModeRecycle:
+		if flags.WorkerConnRecycleInterval <= 0 {
+			return fmt.Errorf("recycle connection mode requires a positive recycle interval")
+		}
+	default:
+		return fmt.Errorf("unknown connection mode %q", flags.WorkerConnMode)
+	}
+	if flags.WorkerConnMaxIdle < 0 || flags.WorkerConnMaxPerHost < 0 || flags.WorkerConnIdleTimeout < 0 {
+		return fmt.Errorf("connection limits must not be negative")
+	}
+
+	// Build the transport
+	t := &connTransport{newTransport: func() *http.Transport { return newTransport(flags) }}
+	t.current.Store(t.newTransport())
+	httpClient = &http.Client{Transport: otelhttp.NewTransport(t)}
+
+	// Replace the pool periodically
+	if flags.WorkerConnMode == ConnModeRecycle {
+		go t.recycle(ctx, flags.WorkerConnRecycleInterval)
+	}
+
+	log.Info("http client connections", "mode", flags.WorkerConnMode)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// newTransport returns a transport configured for the connection mode, whose
+// connections are counted while open.
+//-----------------------------------------------------------------------------
+
+func newTransport(flags *common.FlagPack) *http.Transport {
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DisableKeepAlives = flags.WorkerConnMode == ConnModeNew
+	t.MaxIdleConnsPerHost = flags.WorkerConnMaxIdle
+	t.MaxConnsPerHost = flags.WorkerConnMaxPerHost
+	t.IdleConnTimeout = flags.WorkerConnIdleTimeout
+	if clientTLS != nil {
+		t.TLSClientConfig = clientTLS.Clone()
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		connsOpen.Inc()
+		return &countedConn{Conn: conn}, nil
+	}
+
+	return t
+}
+
+//-----------------------------------------------------------------------------
+// countedConn decrements the open connections gauge once, on close
+//-----------------------------------------------------------------------------
+
+type countedConn struct {
+	net.Conn
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(connsOpen.Dec)
+	return c.Conn.Close()
+}
+
+//-----------------------------------------------------------------------------
+// connTransport sends requests through the current pool and records how
+// their connections were obtained.
+//-----------------------------------------------------------------------------
+
+type connTransport struct {
+	newTransport func() *http.Transport
+	current      atomic.Pointer[http.Transport]
+}
+
+func (t *connTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	var dialStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(string, string) {
+			dialStart = time.Now()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				connDialDuration.Observe(time.Since(dialStart).Seconds())
+			}
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			result := "ok"
+			if err != nil {
+				result = "error"
+			}
+			tlsHandshakeDuration.WithLabelValues(result).Observe(time.Since(tlsStart).Seconds())
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			connsAcquired.WithLabelValues(strconv.FormatBool(info.Reused)).Inc()
+		},
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.current.Load().RoundTrip(req)
+}
+
+//-----------------------------------------------------------------------------
+// recycle swaps in a fresh pool every interval. The retired pool's idle
+// connections are closed right away, and those still busy at the time are
+// closed at the next swap, once they have gone idle.
+//-----------------------------------------------------------------------------
+
+func (t *connTransport) recycle(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var retired *http.Transport
+	for {
+		select {
+		case <-ticker.C:
+			if retired != nil {
+				retired.CloseIdleConnections()
+			}
+			retired = t.current.Swap(t.newTransport())
+			retired.CloseIdleConnections()
+			connsRecycled.Inc()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	// Community
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Fault injection
+//
+// The worker server can misbehave on purpose so that mesh retries, outlier
+// detection and timeouts can be exercised without Istio fault-injection
+// config. Faults are seeded from the --worker-fault-* flags and can be
+// changed at runtime through /fault on the worker admin server, which is
+// off unless --worker-admin-bind-address is set and is not exposed by the
+// peer Service.
+//-----------------------------------------------------------------------------
+
+const (
+	DelayFixed       = "fixed"
+	DelayUniform     = "uniform"
+	DelayNormal      = "normal"
+	DelayExponential = "exponential"
+)
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+var faultsInjected = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kswarm",
+	Subsystem: "worker",
+	Name:      "faults_injected_total",
+	Help:      "Number of faults injected by the worker server, by type: error, delay, reset or partial.",
+}, []string{"type"})
+
+func init() {
+	registry.MustRegister(faultsInjected)
+}
+
+//-----------------------------------------------------------------------------
+// faultConfig is the set of faults applied to every /data request. Rates are
+// probabilities in [0, 1]. Reset, error and partial are mutually exclusive
+// outcomes of a single draw, so their rates must add up to at most 1; delay
+// is drawn independently and applies before any of them.
+//-----------------------------------------------------------------------------
+
+type faultConfig struct {
+	ErrorRate         float64
+	ErrorCodes        []int
+	DelayRate         float64
+	Delay             time.Duration
+	DelayDistribution string
+	DelaySpread       time.Duration
+	ResetRate         float64
+	PartialRate       float64
+}
+
+// faults is the live config, faultFlags the one set by the flags
+var (
+	faults     atomic.Pointer[faultConfig]
+	faultFlags faultConfig
+)
+
+//-----------------------------------------------------------------------------
+// setupFaults validates the fault flags and makes them the live config
+//-----------------------------------------------------------------------------
+
+func setupFaults(flags *common.FlagPack) error {
+
+	f := faultConfig{
+		ErrorRate:         flags.WorkerFaultErrorRate,
+		ErrorCodes:        flags.WorkerFaultErrorCodes,
+		DelayRate:         flags.WorkerFaultDelayRate,
+		Delay:             flags.WorkerFaultDelay,
+		DelayDistribution: flags.WorkerFaultDelayDistribution,
+		DelaySpread:       flags.WorkerFaultDelaySpread,
+		ResetRate:         flags.WorkerFaultResetRate,
+		PartialRate:       flags.WorkerFaultPartialRate,
+	}
+	if err := f.validate(); err != nil {
+		return err
+	}
+
+	faultFlags = f
+	faults.Store(&f)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// validate checks that the config can be applied
+//-----------------------------------------------------------------------------
+
+func (f faultConfig) validate() error {
+
+	// Rates
+	for name, rate := range map[string]float64{
+		"error rate":   f.ErrorRate,
+		"delay rate":   f.DelayRate,
+		"reset rate":   f.ResetRate,
+		"partial rate": f.PartialRate,
+	} {
+		if math.IsNaN(rate) || rate < 0 || rate > 1 {
+			return fmt.Errorf("fault %s must be in [0, 1], got %v", name, rate)
+		}
+	}
+	if sum := f.ErrorRate + f.ResetRate + f.PartialRate; sum > 1 {
+		return fmt.Errorf("fault error, reset and partial rates must add up to at most 1, got %v", sum)
+	}
+
+	// Error codes
+	if f.ErrorRate > 0 && len(f.ErrorCodes) == 0 {
+		return fmt.Errorf("fault error rate requires at least one error code")
+	}
+	for _, code := range f.ErrorCodes {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("fault error code must be a 4xx or 5xx status, got %d", code)
+		}
+	}
+
+	// Delay
+	switch f.DelayDistribution {
+	case DelayFixed, DelayUniform, DelayNormal, DelayExponential:
+	default:
+		return fmt.Errorf("unknown fault delay distribution %q", f.DelayDistribution)
+	}
+	if f.Delay < 0 || f.DelaySpread < 0 {
+		return fmt.Errorf("fault delay and spread must not be negative")
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// sampleDelay draws a delay from the configured distribution. Delay is the
+// fixed value or the mean; spread is the half-width of the uniform range or
+// the standard deviation of the normal distribution.
+//-----------------------------------------------------------------------------
+
+func (f faultConfig) sampleDelay() time.Duration {
+
+	d := float64(f.Delay)
+	switch f.DelayDistribution {
+	case DelayUniform:
+		d += (2*rand.Float64() - 1) * float64(f.DelaySpread)
+	case DelayNormal:
+		d += rand.NormFloat64() * float64(f.DelaySpread)
+	case DelayExponential:
+		d = rand.ExpFloat64() * d
+	}
+	return time.Duration(math.Max(d, 0))
+}
+
+//-----------------------------------------------------------------------------
+// injectFaults is the gin middleware in front of /data
+//-----------------------------------------------------------------------------
+
+func injectFaults(c *gin.Context) {
+
+	f := faults.Load()
+
+	// Delay
+	if f.Delay > 0 && rand.Float64() < f.DelayRate {
+		faultsInjected.WithLabelValues("delay").Inc()
+		timer := time.NewTimer(f.sampleDelay())
+		select {
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+			timer.Stop()
+			c.Abort()
+			return
+		}
+	}
+
+	// At most one of reset, error or partial
+	u := rand.Float64()
+	switch {
+	case u < f.ResetRate:
+		faultsInjected.WithLabelValues("reset").Inc()
+		resetConn(c)
+	case u < f.ResetRate+f.ErrorRate:
+		faultsInjected.WithLabelValues("error").Inc()
+		code := f.ErrorCodes[rand.N(len(f.ErrorCodes))]
+		c.AbortWithStatusJSON(code, gin.H{"error": "injected fault"})
+	case u < f.ResetRate+f.ErrorRate+f.PartialRate:
+		faultsInjected.WithLabelValues("partial").Inc()
+		partialResponse(c)
+	default:
+		c.Next()
+	}
+}
+
+//-----------------------------------------------------------------------------
+// resetConn drops the connection with a TCP RST instead of a response
+//-----------------------------------------------------------------------------
+
+func resetConn(c *gin.Context) {
+
+	c.Abort()
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		log.Error(err, "unable to hijack connection for reset fault")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	// A zero linger turns Close into an RST
+	if tcp, ok := tcpConn(conn); ok {
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+//-----------------------------------------------------------------------------
+// tcpConn digs the *net.TCPConn out of a connection, unwrapping TLS
+//-----------------------------------------------------------------------------
+
+func tcpConn(conn net.Conn) (*net.TCPConn, bool) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	return tcp, ok
+}
+
+//-----------------------------------------------------------------------------
+// partialResponse announces the full /data body but sends only half of it
+// before closing the connection.
+//-----------------------------------------------------------------------------
+
+func partialResponse(c *gin.Context) {
+
+	c.Abort()
+	body, err := json.Marshal(localPeer())
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := c.Writer.Hijack()
+	if err != nil {
+		log.Error(err, "unable to hijack connection for partial fault")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	_, _ = fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: application/json; charset=utf-8\r\nContent-Length: %d\r\n\r\n", len(body))
+	_, _ = buf.Write(body[:len(body)/2])
+	_ = buf.Flush()
+}
+
+//-----------------------------------------------------------------------------
+// adminServer serves the /fault endpoint. It is unauthenticated and mutating,
+// so it only runs when asked for, on its own listener, and never on the
+// scraped metrics port.
+//-----------------------------------------------------------------------------
+
+func adminServer(ctx context.Context, flags *common.FlagPack) error {
+
+	// "0" disables the endpoint, same as --worker-metrics-bind-address.
+	if flags.WorkerAdminAddr == "0" {
+		return nil
+	}
+
+	// Routes
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fault", faultHandler)
+
+	// Start the server
+	srv := &http.Server{
+		Addr:              flags.WorkerAdminAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return common.Serve(ctx, srv, flags.ShutdownDrainPeriod, srv.ListenAndServe)
+}
+
+//-----------------------------------------------------------------------------
+// faultHandler serves /fault. GET returns the live config, PUT updates the
+// fields given as query parameters (named like the --worker-fault-* flags
+// without the prefix) and DELETE restores the flag values.
+//
+//   curl -X PUT 'localhost:8087/fault?error-rate=0.2&error-codes=503,504'
+//-----------------------------------------------------------------------------
+
+func faultHandler(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		f := *faults.Load()
+		f.ErrorCodes = slices.Clone(f.ErrorCodes)
+		for key, values := range r.URL.Query() {
+			if err := f.set(key, values[len(values)-1]); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := f.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		faults.Store(&f)
+		log.Info("fault config updated", "fault", f)
+	case http.MethodDelete:
+		f := faultFlags
+		faults.Store(&f)
+		log.Info("fault config reset", "fault", f)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(faults.Load()); err != nil {
+		log.Error(err, "failed to write fault config")
+	}
+}
+
+//-----------------------------------------------------------------------------
+// set updates one field from its query parameter
+//-----------------------------------------------------------------------------
+
+func (f *faultConfig) set(key, value string) error {
+
+	var err error
+	switch key {
+	case "error-rate":
+		f.ErrorRate, err = strconv.ParseFloat(value, 64)
+	case "error-codes":
+		f.ErrorCodes = nil
+		for _, s := range strings.Split(value, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", key, err)
+			}
+			f.ErrorCodes = append(f.ErrorCodes, code)
+		}
+	case "delay-rate":
+		f.DelayRate, err = strconv.ParseFloat(value, 64)
+	case "delay":
+		f.Delay, err = time.ParseDuration(value)
+	case "delay-distribution":
+		f.DelayDistribution = value
+	case "delay-spread":
+		f.DelaySpread, err = time.ParseDuration(value)
+	case "reset-rate":
+		f.ResetRate, err = strconv.ParseFloat(value, 64)
+	case "partial-rate":
+		f.PartialRate, err = strconv.ParseFloat(value, 64)
+	default:
+		return fmt.Errorf("unknown fault parameter %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// MarshalJSON renders the config with the query parameter names and
+// human-readable durations, for /fault and the logs.
+//-----------------------------------------------------------------------------
+
+func (f faultConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ErrorRate         float64 `json:"error-rate"`
+		ErrorCodes        []int   `json:"error-codes"`
+		DelayRate         float64 `json:"delay-rate"`
+		Delay             string  `json:"delay"`
+		DelayDistribution string  `json:"delay-distribution"`
+		DelaySpread       string  `json:"delay-spread"`
+		ResetRate         float64 `json:"reset-rate"`
+		PartialRate       float64 `json:"partial-rate"`
+	}{
+		ErrorRate:         f.ErrorRate,
+		ErrorCodes:        f.ErrorCodes,
+		DelayRate:         f.DelayRate,
+		Delay:             f.Delay.String(),
+		DelayDistribution: f.DelayDistribution,
+		DelaySpread:       f.DelaySpread.String(),
+		ResetRate:         f.ResetRate,
+		PartialRate:       f.PartialRate,
+	})
+}
@@ -0,0 +1,190 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	// Community
+	"github.com/gin-gonic/gin"
+)
+
+//-----------------------------------------------------------------------------
+// TestFaultConfigValidate
+//-----------------------------------------------------------------------------
+
+func TestFaultConfigValidate(t *testing.T) {
+
+	valid := faultConfig{ErrorCodes: []int{503}, DelayDistribution: DelayFixed}
+
+	tests := []struct {
+		name   string
+		modify func(f *faultConfig)
+		err    bool
+	}{
+		{name: "no faults", modify: func(*faultConfig) {}},
+		{name: "all rates", modify: func(f *faultConfig) { f.ErrorRate, f.ResetRate, f.PartialRate, f.DelayRate = 0.3, 0.3, 0.4, 1 }},
+		{name: "rate above 1", modify: func(f *faultConfig) { f.DelayRate = 1.1 }, err: true},
+		{name: "negative rate", modify: func(f *faultConfig) { f.ResetRate = -0.1 }, err: true},
+		{name: "NaN rate", modify: func(f *faultConfig) { f.ErrorRate = math.NaN() }, err: true},
+		{name: "outcomes above 1", modify: func(f *faultConfig) { f.ErrorRate, f.ResetRate, f.PartialRate = 0.5, 0.3, 0.3 }, err: true},
+		{name: "errors without codes", modify: func(f *faultConfig) { f.ErrorRate, f.ErrorCodes = 0.1, nil }, err: true},
+		{name: "2xx code", modify: func(f *faultConfig) { f.ErrorCodes = []int{200} }, err: true},
+		{name: "unknown distribution", modify: func(f *faultConfig) { f.DelayDistribution = "pareto" }, err: true},
+		{name: "negative delay", modify: func(f *faultConfig) { f.Delay = -time.Second }, err: true},
+		{name: "negative spread", modify: func(f *faultConfig) { f.DelaySpread = -time.Second }, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := valid
+			tt.modify(&f)
+			if err := f.validate(); (err != nil) != tt.err {
+				t.Errorf("got error %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestSampleDelay checks the range of every delay distribution
+//-----------------------------------------------------------------------------
+
+func TestSampleDelay(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		dist     string
+		min, max time.Duration
+	}{
+		{name: DelayFixed, dist: DelayFixed, min: 100 * time.Millisecond, max: 100 * time.Millisecond},
+		{name: DelayUniform, dist: DelayUniform, min: 80 * time.Millisecond, max: 120 * time.Millisecond},
+		{name: DelayNormal, dist: DelayNormal, min: 0, max: time.Duration(math.MaxInt64)},
+		{name: DelayExponential, dist: DelayExponential, min: 0, max: time.Duration(math.MaxInt64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := faultConfig{Delay: 100 * time.Millisecond, DelayDistribution: tt.dist, DelaySpread: 20 * time.Millisecond}
+			for range 1000 {
+				if d := f.sampleDelay(); d < tt.min || d > tt.max {
+					t.Fatalf("got %s, want within [%s, %s]", d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestInjectFaults serves /data behind the middleware with every fault
+// certain to happen and checks what the client sees.
+//-----------------------------------------------------------------------------
+
+func TestInjectFaults(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/data", injectFaults, func(c *gin.Context) { c.JSON(http.StatusOK, localPeer()) })
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	prev := faults.Load()
+	defer faults.Store(prev)
+
+	tests := []struct {
+		name     string
+		fault    faultConfig
+		status   int
+		err      bool
+		minDelay time.Duration
+	}{
+		{name: "none", fault: faultConfig{}, status: http.StatusOK},
+		{name: "error", fault: faultConfig{ErrorRate: 1, ErrorCodes: []int{http.StatusServiceUnavailable}}, status: http.StatusServiceUnavailable},
+		{name: "delay", fault: faultConfig{DelayRate: 1, Delay: 50 * time.Millisecond, DelayDistribution: DelayFixed}, status: http.StatusOK, minDelay: 50 * time.Millisecond},
+		{name: "reset", fault: faultConfig{ResetRate: 1}, err: true},
+		{name: "partial", fault: faultConfig{PartialRate: 1}, status: http.StatusOK, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.fault
+			faults.Store(&f)
+
+			// Keep connections apart, so that a fault cannot break the next case
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			start := time.Now()
+			resp, err := client.Get(srv.URL + "/data")
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+			}
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if resp != nil && resp.StatusCode != tt.status {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minDelay {
+				t.Errorf("answered after %s, want at least %s", elapsed, tt.minDelay)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestFaultHandler updates, reads and resets the live config through /fault
+//-----------------------------------------------------------------------------
+
+func TestFaultHandler(t *testing.T) {
+
+	prev, prevFlags := faults.Load(), faultFlags
+	defer func() { faults.Store(prev); faultFlags = prevFlags }()
+	faultFlags = faultConfig{ErrorCodes: []int{503}, DelayDistribution: DelayFixed}
+	f := faultFlags
+	faults.Store(&f)
+
+	tests := []struct {
+		name      string
+		method    string
+		query     string
+		status    int
+		errorRate float64
+	}{
+		{name: "get", method: http.MethodGet, status: http.StatusOK},
+		{name: "put", method: http.MethodPut, query: "error-rate=0.2&error-codes=500,504", status: http.StatusOK, errorRate: 0.2},
+		{name: "put unknown", method: http.MethodPut, query: "rate=1", status: http.StatusBadRequest, errorRate: 0.2},
+		{name: "put invalid", method: http.MethodPut, query: "reset-rate=0.9", status: http.StatusBadRequest, errorRate: 0.2},
+		{name: "put malformed", method: http.MethodPut, query: "delay=soon", status: http.StatusBadRequest, errorRate: 0.2},
+		{name: "delete", method: http.MethodDelete, status: http.StatusOK},
+		{name: "post", method: http.MethodPost, status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			faultHandler(w, httptest.NewRequest(tt.method, "/fault?"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := faults.Load().ErrorRate; got != tt.errorRate {
+				t.Errorf("got live error rate %v, want %v", got, tt.errorRate)
+			}
+			if w.Code == http.StatusOK {
+				var body map[string]any
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error-rate"] != tt.errorRate {
+					t.Errorf("got body %s, want the live config", w.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Community
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// The gRPC peer service is declared by hand instead of generated from a
+// .proto file: it takes a google.protobuf.Empty and returns the peerInfo as a
+// google.protobuf.Struct, so the well-known types are all it needs.
+//
+//   service kswarm.v1.Peer {
+//     rpc GetData(google.protobuf.Empty) returns (google.protobuf.Struct);
+//   }
+//-----------------------------------------------------------------------------
+
+const getDataMethod = "/kswarm.v1.Peer/GetData"
+
+type peerServer interface {
+	GetData(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+}
+
+var peerServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kswarm.v1.Peer",
+	HandlerType: (*peerServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "GetData",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+			in := new(emptypb.Empty)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			return srv.(peerServer).GetData(ctx, in)
+		},
+	}},
+	Metadata: "kswarm/v1/peer.proto",
+}
+
+//-----------------------------------------------------------------------------
+// grpcInfo groups gRPC-level fields under a single nested object in the log
+// line, mirroring httpInfo.
+//-----------------------------------------------------------------------------
+
+type grpcInfo struct {
+	Code string `json:"code"`
+}
+
+//-----------------------------------------------------------------------------
+// grpcServer starts the worker gRPC server
+//-----------------------------------------------------------------------------
+
+func grpcServer(ctx context.Context, flags *common.FlagPack) error {
+
+	// "0" disables the server
+	if flags.WorkerGRPCBindAddr == "0" {
+		log.Info("worker grpc server disabled")
+		return nil
+	}
+
+	// Listen
+	lis, err := net.Listen("tcp", flags.WorkerGRPCBindAddr)
+	if err != nil {
+		return err
+	}
+
+	// Stop gracefully once drained
+	srv := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	srv.RegisterService(&peerServiceDesc, peerService{})
+	stop := context.AfterFunc(ctx, func() {
+		time.Sleep(flags.ShutdownDrainPeriod)
+		srv.GracefulStop()
+	})
+	defer stop()
+
+	// Serve
+	return srv.Serve(lis)
+}
+
+//-----------------------------------------------------------------------------
+// peerService implements kswarm.v1.Peer
+//-----------------------------------------------------------------------------
+
+type peerService struct{}
+
+func (peerService) GetData(context.Context, *emptypb.Empty) (*structpb.Struct, error) {
+
+	// Round-trip through JSON so the Struct carries the same keys as /data
+	b, err := json.Marshal(localPeer())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return structpb.NewStruct(m)
+}
+
+//-----------------------------------------------------------------------------
+// grpcConns caches one client connection per destination. gRPC multiplexes
+// calls over it, the same way the default HTTP transport pools connections.
+// The connection is closed once the peer is no longer in the service list.
+//-----------------------------------------------------------------------------
+
+var grpcConns sync.Map
+
+func grpcConn(service string) (*grpc.ClientConn, error) {
+	if conn, ok := grpcConns.Load(service); ok {
+		return conn.(*grpc.ClientConn), nil
+	}
+	addr, _ := splitDestination(service)
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if prev, loaded := grpcConns.LoadOrStore(service, conn); loaded {
+		_ = conn.Close()
+		return prev.(*grpc.ClientConn), nil
+	}
+	return conn, nil
+}
+
+//-----------------------------------------------------------------------------
+// closeGRPCConns closes the connections to the peers not in the service
+// list, including those that calls in flight cached after their peer left.
+//-----------------------------------------------------------------------------
+
+func closeGRPCConns(services []string) {
+	keep := make(map[string]bool, len(services))
+	for _, service := range services {
+		keep[service] = true
+	}
+	grpcConns.Range(func(service, conn any) bool {
+		if !keep[service.(string)] && grpcConns.CompareAndDelete(service, conn) {
+			_ = conn.(*grpc.ClientConn).Close()
+		}
+		return true
+	})
+}
+
+//-----------------------------------------------------------------------------
+// grpcCall makes a single kswarm.v1.Peer/GetData call to a peer
+//-----------------------------------------------------------------------------
+
+func grpcCall(ctx context.Context, _ *common.FlagPack, service string) hopResult {
+
+	// Get a connection
+	conn, err := grpcConn(service)
+	if err != nil {
+		return hopResult{err: err}
+	}
+
+	// Call the peer
+	if n := attemptFrom(ctx); n > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(attemptHeader), strconv.Itoa(n))
+	}
+	if _, cluster := splitDestination(service); cluster != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(clusterHeader), cluster)
+	}
+	start := time.Now()
+	out := new(structpb.Struct)
+	err = conn.Invoke(ctx, getDataMethod, &emptypb.Empty{}, out)
+	duration := time.Since(start)
+
+	// gRPC reports connection failures as Unavailable, just like a proxy
+	// answering 503, so only our own cancellation is a client-side error.
+	code := status.Code(err)
+	if code == codes.Canceled {
+		return hopResult{err: err, duration: duration}
+	}
+	res := hopResult{status: grpcHTTPStatus(code), duration: duration, info: grpcInfo{Code: code.String()}}
+	if err != nil {
+		res.body = []byte(status.Convert(err).Message())
+		return res
+	}
+
+	// Parse the peer identity
+	body, err := out.MarshalJSON()
+	if err != nil {
+		return hopResult{err: err, duration: duration}
+	}
+	if err := json.Unmarshal(body, &res.dst); err != nil {
+		res.body = body
+	}
+	return res
+}
+
+//-----------------------------------------------------------------------------
+// grpcHTTPStatus maps a gRPC code to the HTTP status used for metrics, the
+// same way grpc-gateway does.
+//-----------------------------------------------------------------------------
+
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,56 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"testing"
+
+	// Community
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+//-----------------------------------------------------------------------------
+// TestCloseGRPCConns caches connections, one of them to a peer that already
+// left, and checks that only those to the peers in the list are kept.
+//-----------------------------------------------------------------------------
+
+func TestCloseGRPCConns(t *testing.T) {
+
+	// Cache the connections
+	conns := map[string]*grpc.ClientConn{}
+	for _, service := range []string{"a:80", "b:80", "left:80"} {
+		conn, err := grpcConn(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[service] = conn
+	}
+	defer closeGRPCConns(nil)
+
+	// Apply a list without b and the peer that left
+	closeGRPCConns([]string{"a:80", "c:80"})
+
+	tests := []struct {
+		service string
+		kept    bool
+	}{
+		{service: "a:80", kept: true},
+		{service: "b:80", kept: false},
+		{service: "left:80", kept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			_, cached := grpcConns.Load(tt.service)
+			closed := conns[tt.service].GetState() == connectivity.Shutdown
+			if cached != tt.kept || closed == tt.kept {
+				t.Errorf("got cached %v and closed %v, want kept %v", cached, closed, tt.kept)
+			}
+		})
+	}
+}
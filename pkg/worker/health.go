@@ -0,0 +1,126 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Health probes
+//
+// /healthz passes for as long as the worker serves it. /readyz passes once
+// the peer list was fetched from the informer at least once and, with
+// --worker-ready-min-reachable, while at least that fraction of the peers
+// answered successfully within --worker-stats-window. It fails as soon as
+// the worker starts shutting down, so that it leaves its Service while
+// draining. Both are served on the metrics port, or on their own listener
+// with --worker-health-probe-bind-address, which are plaintext and outside
+// the mesh authorization policies, so the kubelet can always reach them.
+//-----------------------------------------------------------------------------
+
+//-----------------------------------------------------------------------------
+// validateReadiness checks the readiness flags
+//-----------------------------------------------------------------------------
+
+func validateReadiness(flags *common.FlagPack) error {
+	if r := flags.WorkerReadyMinReachable; r < 0 || r > 1 {
+		return fmt.Errorf("ready min reachable must be in [0, 1], got %v", r)
+	}
+	if flags.WorkerMetricsAddr == "0" && flags.WorkerProbeAddr == "" {
+		return errors.New("the health probes are served on the disabled metrics server, set a health probe bind address or '0' to disable them too")
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// probeRoutes adds the /healthz and /readyz probes to a mux
+//-----------------------------------------------------------------------------
+
+func probeRoutes(ctx context.Context, flags *common.FlagPack, mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", readyz(ctx, flags))
+}
+
+//-----------------------------------------------------------------------------
+// probeServer serves the health probes on their own listener, when they are
+// not served on the metrics server.
+//-----------------------------------------------------------------------------
+
+func probeServer(ctx context.Context, flags *common.FlagPack) error {
+
+	// Empty serves the probes on the metrics server, "0" disables them.
+	if flags.WorkerProbeAddr == "" || flags.WorkerProbeAddr == "0" {
+		return nil
+	}
+
+	// Routes
+	mux := http.NewServeMux()
+	probeRoutes(ctx, flags, mux)
+
+	// Start the server
+	srv := &http.Server{
+		Addr:              flags.WorkerProbeAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return common.Serve(ctx, srv, flags.ShutdownDrainPeriod, srv.ListenAndServe)
+}
+
+//-----------------------------------------------------------------------------
+// ready returns why the worker is not ready, or nil
+//-----------------------------------------------------------------------------
+
+func ready(ctx context.Context, flags *common.FlagPack) error {
+
+	// Draining
+	if ctx.Err() != nil {
+		return errors.New("shutting down")
+	}
+
+	// Initial fetch
+	if !peers.fetched() {
+		return errors.New("peer list not fetched from the informer yet")
+	}
+
+	// Peer reachability, leaving out the peers without ready endpoints. With
+	// none ready it passes, or a starting swarm would never become ready.
+	services := peers.readySnapshot()
+	if flags.WorkerReadyMinReachable > 0 && len(services) > 0 {
+		n := stats.reachable(services)
+		if ratio := float64(n) / float64(len(services)); ratio < flags.WorkerReadyMinReachable {
+			return fmt.Errorf("%d of %d peers reachable, below the minimum ratio of %v", n, len(services), flags.WorkerReadyMinReachable)
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// healthz answers the liveness probe
+//-----------------------------------------------------------------------------
+
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+//-----------------------------------------------------------------------------
+// readyz answers the readiness probe
+//-----------------------------------------------------------------------------
+
+func readyz(ctx context.Context, flags *common.FlagPack) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if err := ready(ctx, flags); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
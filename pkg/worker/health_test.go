@@ -0,0 +1,100 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"testing"
+	"time"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// TestReady checks the readiness of a worker against the peers it reached
+//-----------------------------------------------------------------------------
+
+func TestReady(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		fetched   bool
+		services  []string
+		unready   []string
+		reached   []string
+		min       float64
+		cancelled bool
+		ready     bool
+	}{
+		{name: "not fetched", min: 0.5},
+		{name: "shutting down", fetched: true, cancelled: true},
+		{name: "not checked", fetched: true, services: []string{"a:80", "b:80"}, ready: true},
+		{name: "no peers", fetched: true, min: 1, ready: true},
+		{
+			name:     "no ready peers",
+			fetched:  true,
+			services: []string{"a:80", "b:80"},
+			unready:  []string{"a:80", "b:80"},
+			min:      1,
+			ready:    true,
+		},
+		{
+			name:     "enough reached",
+			fetched:  true,
+			services: []string{"a:80", "b:80"},
+			reached:  []string{"a:80"},
+			min:      0.5,
+			ready:    true,
+		},
+		{
+			name:     "too few reached",
+			fetched:  true,
+			services: []string{"a:80", "b:80"},
+			reached:  []string{"a:80"},
+			min:      1,
+		},
+		{
+			name:     "unready peers left out",
+			fetched:  true,
+			services: []string{"a:80", "b:80"},
+			unready:  []string{"b:80"},
+			reached:  []string{"a:80"},
+			min:      1,
+			ready:    true,
+		},
+	}
+
+	prevPeers, prevStats := peers, stats
+	defer func() { peers, stats = prevPeers, prevStats }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// The peers known and those reached
+			peers = newPeerRegistry()
+			if tt.fetched {
+				peers.update(tt.services, tt.unready)
+			}
+			stats = &statsStore{window: time.Minute, samples: 1, dests: map[string]*destStats{}}
+			for _, service := range tt.reached {
+				stats.record(service, hopResult{status: 200})
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelled {
+				cancel()
+			}
+
+			err := ready(ctx, &common.FlagPack{WorkerReadyMinReachable: tt.min})
+			if (err == nil) != tt.ready {
+				t.Errorf("got %v, want ready %v", err, tt.ready)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package worker
+
+import (
+
+	// Stdlib
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	// Community
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+// hopLabels are shared by every per-hop metric so that the synthetic traffic
+// matrix can be sliced by source, destination and outcome.
+var hopLabels = []string{
+	"src_cluster",
+	"src_namespace",
+	"dst_cluster",
+	"dst_namespace",
+	"status_class",
+}
+
+var (
+	registry = prometheus.NewRegistry()
+
+	hopDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests sent by the worker to its peers.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, hopLabels)
+
+	hopRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "requests_total",
+		Help:      "Number of requests sent by the worker to its peers.",
+	}, hopLabels)
+
+	hopErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "request_errors_total",
+		Help:      "Number of requests that failed at the transport level or returned a non-2xx status.",
+	}, hopLabels)
+
+	hopExpectedErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "request_expected_errors_total",
+		Help:      "Number of the request errors that hit a destination the informer marked as having no ready endpoints.",
+	}, hopLabels)
+)
+
+//-----------------------------------------------------------------------------
+// init
+//-----------------------------------------------------------------------------
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		hopDuration,
+		hopRequests,
+		hopErrors,
+		hopExpectedErrors,
+	)
+}
+
+//-----------------------------------------------------------------------------
+// metricsServer serves the worker's Prometheus registry and, unless they have
+// their own listener, the /healthz and /readyz probes.
+//-----------------------------------------------------------------------------
+
+func metricsServer(ctx context.Context, flags *common.FlagPack) error {
+
+	// "0" disables the endpoint, same as --metrics-bind-address.
+	if flags.WorkerMetricsAddr == "0" {
+		log.Info("worker metrics server disabled")
+		return nil
+	}
+
+	// Routes
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	if flags.WorkerProbeAddr == "" {
+		probeRoutes(ctx, flags, mux)
+	}
+
+	// Start the server
+	srv := &http.Server{
+		Addr:              flags.WorkerMetricsAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return common.Serve(ctx, srv, flags.ShutdownDrainPeriod, srv.ListenAndServe)
+}
+
+//-----------------------------------------------------------------------------
+// observeHop records the outcome of a single request in the hop metrics.
+// Errors are also counted as expected when the destination is unready.
+//-----------------------------------------------------------------------------
+
+func observeHop(src, dst peerInfo, service string, status int, err error, duration time.Duration, unready bool) {
+
+	// Label values
+	class := statusClass(status, err)
+	labels := peerLabels(src, dst, service)
+	labels["status_class"] = class
+
+	// Record
+	hopRequests.With(labels).Inc()
+	hopDuration.With(labels).Observe(duration.Seconds())
+	if class != "2xx" && class != "ok" {
+		hopErrors.With(labels).Inc()
+		if unready {
+			hopExpectedErrors.With(labels).Inc()
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// peerLabels returns the source and destination labels of a call. dst may be
+// the zero value when the peer could not be reached, in which case the
+// destination namespace and cluster are derived from the destination.
+//-----------------------------------------------------------------------------
+
+func peerLabels(src, dst peerInfo, service string) prometheus.Labels {
+
+	// Fill in what we know about an unreachable destination
+	if dst.Namespace == "" {
+		dst.Namespace = serviceNamespace(service)
+	}
+	if dst.Cluster == "" {
+		_, cluster := splitDestination(service)
+		dst.Cluster = cmp.Or(cluster, "unknown")
+	}
+
+	return prometheus.Labels{
+		"src_cluster":   src.Cluster,
+		"src_namespace": src.Namespace,
+		"dst_cluster":   dst.Cluster,
+		"dst_namespace": dst.Namespace,
+	}
+}
+
+//-----------------------------------------------------------------------------
+// statusClass buckets an HTTP status into 2xx/3xx/4xx/5xx, or "error" when
+// the request never got a response. Protocols without a status, such as raw
+// TCP, report "ok" on success.
+//-----------------------------------------------------------------------------
+
+func statusClass(status int, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case status == 0:
+		return "ok"
+	case status < 100:
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+//-----------------------------------------------------------------------------
+// serviceNamespace extracts the namespace from a name.namespace:port address.
+//-----------------------------------------------------------------------------
+
+func serviceNamespace(service string) string {
+	host, _, _ := strings.Cut(service, ":")
+	if _, ns, ok := strings.Cut(host, "."); ok {
+		ns, _, _ = strings.Cut(ns, ".")
+		return ns
+	}
+	return "unknown"
+}
@@ -0,0 +1,153 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	// Community
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//-----------------------------------------------------------------------------
+// Request phases
+//
+// Every HTTP request to a peer is split with httptrace into the DNS lookup,
+// the TCP connect, the TLS handshake, the wait for the first response byte
+// once the request was written, and the transfer of the rest of the body.
+// Requests that reuse a pooled connection skip the first three. Telling the
+// phases apart separates resolver trouble from connect overhead added by a
+// sidecar or ztunnel and from the latency of the peer itself.
+//-----------------------------------------------------------------------------
+
+const (
+	PhaseDNS      = "dns"
+	PhaseConnect  = "connect"
+	PhaseTLS      = "tls"
+	PhaseTTFB     = "ttfb"
+	PhaseTransfer = "transfer"
+)
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+var phaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "kswarm",
+	Subsystem: "worker",
+	Name:      "http_phase_duration_seconds",
+	Help:      "Time spent by worker HTTP requests in each phase: dns, connect, tls, ttfb and transfer.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+}, []string{"phase"})
+
+func init() {
+	registry.MustRegister(phaseDuration)
+}
+
+//-----------------------------------------------------------------------------
+// phases is the breakdown of one request, logged with the hop in
+// milliseconds. Phases the request did not go through are left out.
+//-----------------------------------------------------------------------------
+
+type phases struct {
+	DNS      float64 `json:"dns,omitempty"`
+	Connect  float64 `json:"connect,omitempty"`
+	TLS      float64 `json:"tls,omitempty"`
+	TTFB     float64 `json:"ttfb,omitempty"`
+	Transfer float64 `json:"transfer,omitempty"`
+	Reused   bool    `json:"reused"`
+}
+
+//-----------------------------------------------------------------------------
+// phaseTimer collects the phase boundaries of one request. The hooks may be
+// called from the transport's dialing goroutines, even after the request
+// completed, hence the lock. With several addresses to try only the first
+// connect attempt that succeeds counts.
+//-----------------------------------------------------------------------------
+
+type phaseTimer struct {
+	mu sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wrote, firstByte, done    time.Time
+	reused                    bool
+}
+
+//-----------------------------------------------------------------------------
+// trace returns ctx with the hooks of the timer attached
+//-----------------------------------------------------------------------------
+
+func (t *phaseTimer) trace(ctx context.Context) context.Context {
+
+	// at records now into ts, unless it was set already
+	at := func(ts *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if ts.IsZero() {
+			*ts = time.Now()
+		}
+	}
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { at(&t.dnsStart) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { at(&t.dnsDone) },
+		ConnectStart: func(string, string) { at(&t.connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				at(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { at(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { at(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.reused = info.Reused
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { at(&t.wrote) },
+		GotFirstResponseByte: func() { at(&t.firstByte) },
+	})
+}
+
+//-----------------------------------------------------------------------------
+// finish marks the end of the body transfer, records the phases the request
+// went through and returns them.
+//-----------------------------------------------------------------------------
+
+func (t *phaseTimer) finish() phases {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done.IsZero() {
+		t.done = time.Now()
+	}
+
+	// span observes and returns the duration between two boundaries, or 0
+	// if the request did not get through both.
+	span := func(phase string, from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() || to.Before(from) {
+			return 0
+		}
+		d := to.Sub(from)
+		phaseDuration.WithLabelValues(phase).Observe(d.Seconds())
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	p := phases{Reused: t.reused}
+	if !t.reused {
+		p.DNS = span(PhaseDNS, t.dnsStart, t.dnsDone)
+		p.Connect = span(PhaseConnect, t.connectStart, t.connectDone)
+		p.TLS = span(PhaseTLS, t.tlsStart, t.tlsDone)
+	}
+	p.TTFB = span(PhaseTTFB, t.wrote, t.firstByte)
+	if !t.firstByte.IsZero() {
+		p.Transfer = span(PhaseTransfer, t.firstByte, t.done)
+	}
+	return p
+}
@@ -0,0 +1,126 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//-----------------------------------------------------------------------------
+// TestPhaseTimerFinish checks the spans derived from the phase boundaries
+//-----------------------------------------------------------------------------
+
+func TestPhaseTimerFinish(t *testing.T) {
+
+	t0 := time.Now()
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+
+	tests := []struct {
+		name  string
+		timer *phaseTimer
+		want  phases
+	}{
+		{
+			name: "new connection",
+			timer: &phaseTimer{
+				dnsStart: at(0), dnsDone: at(1),
+				connectStart: at(1), connectDone: at(3),
+				tlsStart: at(3), tlsDone: at(6),
+				wrote: at(6), firstByte: at(10), done: at(15),
+			},
+			want: phases{DNS: 1, Connect: 2, TLS: 3, TTFB: 4, Transfer: 5},
+		},
+		{
+			name: "reused connection",
+			timer: &phaseTimer{
+				dnsStart: at(0), dnsDone: at(1),
+				wrote: at(0), firstByte: at(4), done: at(5),
+				reused: true,
+			},
+			want: phases{TTFB: 4, Transfer: 1, Reused: true},
+		},
+		{
+			name:  "no response",
+			timer: &phaseTimer{connectStart: at(0), connectDone: at(2), wrote: at(2), done: at(3)},
+			want:  phases{Connect: 2},
+		},
+		{
+			name:  "boundaries out of order",
+			timer: &phaseTimer{dnsStart: at(2), dnsDone: at(1), wrote: at(0), firstByte: at(1), done: at(1)},
+			want:  phases{TTFB: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.timer.finish(); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestPhaseTimerTrace makes two requests over one connection and checks that
+// only the first one went through the connect phase.
+//-----------------------------------------------------------------------------
+
+func TestPhaseTimerTrace(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{}}
+
+	tests := []struct {
+		name   string
+		reused bool
+	}{
+		{name: "first request dials", reused: false},
+		{name: "second request reuses", reused: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Make the request
+			var timer phaseTimer
+			req, err := http.NewRequestWithContext(timer.trace(context.Background()), http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			p := timer.finish()
+
+			// Check the phases it went through
+			if p.Reused != tt.reused {
+				t.Errorf("got reused %v, want %v", p.Reused, tt.reused)
+			}
+			if (p.Connect > 0) == tt.reused {
+				t.Errorf("got connect %vms with reused %v", p.Connect, tt.reused)
+			}
+			if p.DNS != 0 || p.TLS != 0 {
+				t.Errorf("got dns %vms and tls %vms, want none for a plain IP", p.DNS, p.TLS)
+			}
+			if p.TTFB < 5 {
+				t.Errorf("got ttfb %vms, want at least 5ms", p.TTFB)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package worker
+
+import (
+
+	// Stdlib
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Profiles
+//-----------------------------------------------------------------------------
+
+const (
+	ProfileConstant = "constant"
+	ProfileRamp     = "ramp"
+	ProfileBurst    = "burst"
+	ProfileSine     = "sine"
+	ProfilePoisson  = "poisson"
+)
+
+// minRateFactor keeps shaped rates from reaching zero, which would turn the
+// next inter-arrival time into an infinite wait.
+const minRateFactor = 0.01
+
+//-----------------------------------------------------------------------------
+// profile shapes the scheduler's request rate over time. next returns the
+// delay until the next request, given the base interval derived from
+// --worker-rate, the current time and the time the scheduler started.
+//-----------------------------------------------------------------------------
+
+type profile interface {
+	next(base time.Duration, now, start time.Time) time.Duration
+}
+
+//-----------------------------------------------------------------------------
+// newProfile returns the profile selected by the worker flags
+//-----------------------------------------------------------------------------
+
+func newProfile(flags *common.FlagPack) (profile, error) {
+
+	// Validate the shared knobs
+	if flags.WorkerProfileJitter < 0 || flags.WorkerProfileJitter >= 1 {
+		return nil, fmt.Errorf("profile jitter must be in [0, 1), got %v", flags.WorkerProfileJitter)
+	}
+
+	// Select the profile
+	var p profile
+	switch flags.WorkerProfile {
+	case ProfileConstant:
+		p = constantProfile{}
+	case ProfileRamp:
+		if flags.WorkerProfilePeriod <= 0 {
+			return nil, fmt.Errorf("ramp profile requires a positive period")
+		}
+		p = rampProfile{period: flags.WorkerProfilePeriod}
+	case ProfileBurst:
+		if flags.WorkerProfilePeriod <= 0 || flags.WorkerProfileBurstDuration <= 0 {
+			return nil, fmt.Errorf("burst profile requires a positive period and burst duration")
+		}
+		if flags.WorkerProfileBurstFactor <= 0 {
+			return nil, fmt.Errorf("burst factor must be positive, got %v", flags.WorkerProfileBurstFactor)
+		}
+		p = burstProfile{
+			period:   flags.WorkerProfilePeriod,
+			duration: flags.WorkerProfileBurstDuration,
+			factor:   flags.WorkerProfileBurstFactor,
+		}
+	case ProfileSine:
+		if flags.WorkerProfilePeriod <= 0 {
+			return nil, fmt.Errorf("sine profile requires a positive period")
+		}
+		if flags.WorkerProfileAmplitude < 0 || flags.WorkerProfileAmplitude > 1 {
+			return nil, fmt.Errorf("sine amplitude must be in [0, 1], got %v", flags.WorkerProfileAmplitude)
+		}
+		p = sineProfile{period: flags.WorkerProfilePeriod, amplitude: flags.WorkerProfileAmplitude}
+	case ProfilePoisson:
+		p = poissonProfile{}
+	default:
+		return nil, fmt.Errorf("unknown profile %q", flags.WorkerProfile)
+	}
+
+	// Optionally add jitter
+	if flags.WorkerProfileJitter > 0 {
+		p = jitterProfile{profile: p, jitter: flags.WorkerProfileJitter}
+	}
+
+	// Return the profile
+	return p, nil
+}
+
+//-----------------------------------------------------------------------------
+// constantProfile sends at the base rate, like a metronome
+//-----------------------------------------------------------------------------
+
+type constantProfile struct{}
+
+func (constantProfile) next(base time.Duration, _, _ time.Time) time.Duration {
+	return base
+}
+
+//-----------------------------------------------------------------------------
+// rampProfile grows the rate linearly from rampFloor to the base rate over
+// one period after the worker starts, then holds it. Starting above zero
+// keeps the very first inter-arrival time bounded.
+//-----------------------------------------------------------------------------
+
+const rampFloor = 0.1
+
+type rampProfile struct {
+	period time.Duration
+}
+
+func (p rampProfile) next(base time.Duration, now, start time.Time) time.Duration {
+	progress := math.Min(float64(now.Sub(start))/float64(p.period), 1)
+	return scale(base, rampFloor+(1-rampFloor)*progress)
+}
+
+//-----------------------------------------------------------------------------
+// burstProfile multiplies the rate by factor during the first duration of
+// every period. Periods are aligned to the wall clock so the whole swarm
+// bursts together.
+//-----------------------------------------------------------------------------
+
+type burstProfile struct {
+	period   time.Duration
+	duration time.Duration
+	factor   float64
+}
+
+func (p burstProfile) next(base time.Duration, now, _ time.Time) time.Duration {
+	if phase(now, p.period) < p.duration {
+		return scale(base, p.factor)
+	}
+	return base
+}
+
+//-----------------------------------------------------------------------------
+// sineProfile swings the rate around the base rate by ±amplitude over one
+// period, modelling day/night cycles. Periods are aligned to the wall clock.
+//-----------------------------------------------------------------------------
+
+type sineProfile struct {
+	period    time.Duration
+	amplitude float64
+}
+
+func (p sineProfile) next(base time.Duration, now, _ time.Time) time.Duration {
+	angle := 2 * math.Pi * float64(phase(now, p.period)) / float64(p.period)
+	return scale(base, 1+p.amplitude*math.Sin(angle))
+}
+
+//-----------------------------------------------------------------------------
+// poissonProfile draws exponentially distributed inter-arrival times with
+// the base interval as mean, i.e. a Poisson arrival process.
+//-----------------------------------------------------------------------------
+
+type poissonProfile struct{}
+
+func (poissonProfile) next(base time.Duration, _, _ time.Time) time.Duration {
+	return time.Duration(rand.ExpFloat64() * float64(base))
+}
+
+//-----------------------------------------------------------------------------
+// jitterProfile randomizes another profile's delay by ±jitter
+//-----------------------------------------------------------------------------
+
+type jitterProfile struct {
+	profile
+	jitter float64
+}
+
+func (p jitterProfile) next(base time.Duration, now, start time.Time) time.Duration {
+	d := p.profile.next(base, now, start)
+	return time.Duration(float64(d) * (1 + p.jitter*(2*rand.Float64()-1)))
+}
+
+//-----------------------------------------------------------------------------
+// Helpers
+//-----------------------------------------------------------------------------
+
+// scale returns the interval for a rate multiplied by factor
+func scale(base time.Duration, factor float64) time.Duration {
+	return time.Duration(float64(base) / math.Max(factor, minRateFactor))
+}
+
+// phase returns the position of now within a wall-clock aligned period
+func phase(now time.Time, period time.Duration) time.Duration {
+	return time.Duration(now.UnixNano() % int64(period))
+}
@@ -0,0 +1,119 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"math"
+	"testing"
+	"time"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// TestNewProfile
+//-----------------------------------------------------------------------------
+
+func TestNewProfile(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		flags common.FlagPack
+		err   bool
+	}{
+		{name: "constant", flags: common.FlagPack{WorkerProfile: ProfileConstant}},
+		{name: "poisson with jitter", flags: common.FlagPack{WorkerProfile: ProfilePoisson, WorkerProfileJitter: 0.5}},
+		{name: "jitter of 1", flags: common.FlagPack{WorkerProfile: ProfileConstant, WorkerProfileJitter: 1}, err: true},
+		{name: "negative jitter", flags: common.FlagPack{WorkerProfile: ProfileConstant, WorkerProfileJitter: -0.1}, err: true},
+		{name: "ramp", flags: common.FlagPack{WorkerProfile: ProfileRamp, WorkerProfilePeriod: time.Minute}},
+		{name: "ramp without period", flags: common.FlagPack{WorkerProfile: ProfileRamp}, err: true},
+		{name: "burst", flags: common.FlagPack{WorkerProfile: ProfileBurst, WorkerProfilePeriod: time.Minute, WorkerProfileBurstDuration: time.Second, WorkerProfileBurstFactor: 10}},
+		{name: "burst without duration", flags: common.FlagPack{WorkerProfile: ProfileBurst, WorkerProfilePeriod: time.Minute, WorkerProfileBurstFactor: 10}, err: true},
+		{name: "burst without factor", flags: common.FlagPack{WorkerProfile: ProfileBurst, WorkerProfilePeriod: time.Minute, WorkerProfileBurstDuration: time.Second}, err: true},
+		{name: "sine", flags: common.FlagPack{WorkerProfile: ProfileSine, WorkerProfilePeriod: time.Minute, WorkerProfileAmplitude: 0.5}},
+		{name: "sine amplitude above 1", flags: common.FlagPack{WorkerProfile: ProfileSine, WorkerProfilePeriod: time.Minute, WorkerProfileAmplitude: 1.5}, err: true},
+		{name: "unknown", flags: common.FlagPack{WorkerProfile: "square"}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newProfile(&tt.flags); (err != nil) != tt.err {
+				t.Errorf("got error %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestProfileNext checks the delays of the deterministic profiles. Times are
+// offsets from the Unix epoch, to which burst and sine periods are aligned.
+//-----------------------------------------------------------------------------
+
+func TestProfileNext(t *testing.T) {
+
+	base := 100 * time.Millisecond
+	epoch := time.Unix(0, 0)
+	at := func(d time.Duration) time.Time { return epoch.Add(d) }
+
+	tests := []struct {
+		name    string
+		profile profile
+		now     time.Duration
+		want    time.Duration
+	}{
+		{name: "constant", profile: constantProfile{}, now: time.Hour, want: base},
+		{name: "ramp start", profile: rampProfile{period: time.Minute}, now: 0, want: 1 * time.Second},
+		{name: "ramp middle", profile: rampProfile{period: time.Minute}, now: 30 * time.Second, want: scale(base, 0.55)},
+		{name: "ramp end", profile: rampProfile{period: time.Minute}, now: time.Hour, want: base},
+		{name: "burst on", profile: burstProfile{period: time.Minute, duration: 10 * time.Second, factor: 4}, now: 5 * time.Second, want: 25 * time.Millisecond},
+		{name: "burst off", profile: burstProfile{period: time.Minute, duration: 10 * time.Second, factor: 4}, now: 30 * time.Second, want: base},
+		{name: "burst next period", profile: burstProfile{period: time.Minute, duration: 10 * time.Second, factor: 4}, now: 65 * time.Second, want: 25 * time.Millisecond},
+		{name: "sine peak", profile: sineProfile{period: time.Minute, amplitude: 0.5}, now: 15 * time.Second, want: scale(base, 1.5)},
+		{name: "sine trough", profile: sineProfile{period: time.Minute, amplitude: 0.5}, now: 45 * time.Second, want: scale(base, 0.5)},
+		{name: "sine full swing floored", profile: sineProfile{period: time.Minute, amplitude: 1}, now: 45 * time.Second, want: scale(base, minRateFactor)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.profile.next(base, at(tt.now), epoch)
+			if diff := got - tt.want; diff < -time.Microsecond || diff > time.Microsecond {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestProfileRandom checks the bounds and mean of the random profiles
+//-----------------------------------------------------------------------------
+
+func TestProfileRandom(t *testing.T) {
+
+	base := 100 * time.Millisecond
+	now := time.Now()
+
+	t.Run("poisson mean", func(t *testing.T) {
+		const n = 20000
+		var sum time.Duration
+		for range n {
+			sum += poissonProfile{}.next(base, now, now)
+		}
+		if mean := sum / n; math.Abs(float64(mean-base)) > 0.05*float64(base) {
+			t.Errorf("got mean %s, want %s within 5%%", mean, base)
+		}
+	})
+
+	t.Run("jitter bounds", func(t *testing.T) {
+		p := jitterProfile{profile: constantProfile{}, jitter: 0.2}
+		for range 1000 {
+			if got := p.next(base, now, now); got < 80*time.Millisecond || got > 120*time.Millisecond {
+				t.Fatalf("got %s, want within 20%% of %s", got, base)
+			}
+		}
+	})
+}
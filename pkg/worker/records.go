@@ -0,0 +1,288 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Hop records
+//
+// With --worker-records set, every hop is also written as one JSON object
+// per line, in a stable schema meant for offline analysis (pandas, DuckDB,
+// jq) rather than for reading logs: "stdout" writes them to standard
+// output, which carries nothing else since logs go to standard error, and
+// any other value is a file path. Files are rotated once they reach
+// --worker-records-max-size-mb, keeping --worker-records-max-files rotated
+// files next to the live one as <path>.1 (newest) to <path>.N (oldest).
+//
+// The schema is versioned by the "v" field; fields are only ever added
+// within a version.
+//-----------------------------------------------------------------------------
+
+const recordSchemaVersion = 1
+
+var records = &recordSink{}
+
+//-----------------------------------------------------------------------------
+// hopRecord is one line of the stream
+//-----------------------------------------------------------------------------
+
+type hopRecord struct {
+	V          int       `json:"v"`
+	Time       time.Time `json:"time"`
+	Src        peerInfo  `json:"src"`
+	Dst        peerInfo  `json:"dst"`
+	Service    string    `json:"service"`
+	Protocol   string    `json:"protocol"`
+	Status     int       `json:"status"`
+	OK         bool      `json:"ok"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Expected   bool      `json:"expected,omitempty"`
+	Attempts   int       `json:"attempts"`
+	DurationMs float64   `json:"duration_ms"`
+	PhasesMs   *phases   `json:"phases_ms,omitempty"`
+	TraceID    string    `json:"trace_id,omitempty"`
+}
+
+//-----------------------------------------------------------------------------
+// Error classes
+//-----------------------------------------------------------------------------
+
+const (
+	ErrorClassTimeout  = "timeout"
+	ErrorClassCanceled = "canceled"
+	ErrorClassDNS      = "dns"
+	ErrorClassRefused  = "refused"
+	ErrorClassReset    = "reset"
+	ErrorClassTLS      = "tls"
+	ErrorClassEOF      = "eof"
+	ErrorClassStatus   = "status"
+	ErrorClassOther    = "other"
+)
+
+//-----------------------------------------------------------------------------
+// errorClass sorts the outcome of a hop into a coarse class, "" when it
+// succeeded.
+//-----------------------------------------------------------------------------
+
+func errorClass(status int, err error) string {
+
+	var dnsErr *net.DNSError
+	var tlsErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var certErr *tls.CertificateVerificationError
+	var netErr net.Error
+
+	switch {
+	case err == nil && status < 400:
+		return ""
+	case err == nil:
+		return ErrorClassStatus
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.As(err, &dnsErr):
+		return ErrorClassDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrorClassReset
+	case errors.As(err, &tlsErr), errors.As(err, &alertErr), errors.As(err, &certErr):
+		return ErrorClassTLS
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClassEOF
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	}
+	return ErrorClassOther
+}
+
+//-----------------------------------------------------------------------------
+// recordSink writes hop records, one per line. The zero value discards them.
+//-----------------------------------------------------------------------------
+
+type recordSink struct {
+	mu       sync.Mutex
+	w        io.Writer
+	file     *os.File
+	path     string
+	size     int64
+	maxSize  int64
+	maxFiles int
+}
+
+//-----------------------------------------------------------------------------
+// setupRecords opens the sink selected by the flags and returns a function
+// that closes it.
+//-----------------------------------------------------------------------------
+
+func setupRecords(flags *common.FlagPack) (func(), error) {
+
+	// Records are optional
+	dest := flags.WorkerRecords
+	if dest == "" {
+		return func() {}, nil
+	}
+
+	// Standard output
+	records.mu.Lock()
+	defer records.mu.Unlock()
+	if dest == "stdout" {
+		records.w = os.Stdout
+		return func() {}, nil
+	}
+
+	// Rotated file
+	if flags.WorkerRecordsMaxSizeMB < 1 || flags.WorkerRecordsMaxFiles < 0 {
+		return nil, fmt.Errorf("records max size must be at least 1MB and max files not negative, got %d and %d", flags.WorkerRecordsMaxSizeMB, flags.WorkerRecordsMaxFiles)
+	}
+	records.path = dest
+	records.maxSize = int64(flags.WorkerRecordsMaxSizeMB) << 20
+	records.maxFiles = flags.WorkerRecordsMaxFiles
+	if err := records.open(); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		records.mu.Lock()
+		defer records.mu.Unlock()
+		if err := records.file.Close(); err != nil {
+			log.Error(err, "failed to close the records file")
+		}
+		records.w = nil
+	}, nil
+}
+
+//-----------------------------------------------------------------------------
+// open opens the live file for appending. Called with the lock held.
+//-----------------------------------------------------------------------------
+
+func (s *recordSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Join(err, f.Close())
+	}
+	s.file, s.w, s.size = f, f, info.Size()
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// rotate shifts the rotated files up by one, dropping the oldest, and starts
+// a new live file. Called with the lock held.
+//-----------------------------------------------------------------------------
+
+func (s *recordSink) rotate() error {
+
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if s.maxFiles == 0 {
+		if err := os.Remove(s.path); err != nil {
+			return err
+		}
+		return s.open()
+	}
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+//-----------------------------------------------------------------------------
+// write appends a record, rotating the file first if it would outgrow the
+// max size.
+//-----------------------------------------------------------------------------
+
+func (s *recordSink) write(rec hopRecord) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return
+	}
+
+	// Encode
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Error(err, "failed to encode hop record")
+		return
+	}
+	line = append(line, '\n')
+
+	// Rotate
+	if s.file != nil && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			log.Error(err, "failed to rotate the records file", "path", s.path)
+			s.w = nil
+			return
+		}
+	}
+
+	// Write
+	n, err := s.w.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		log.Error(err, "failed to write hop record")
+	}
+}
+
+//-----------------------------------------------------------------------------
+// recordHop writes the record of a hop. Failures are flagged as expected
+// when the destination is unready.
+//-----------------------------------------------------------------------------
+
+func recordHop(flags *common.FlagPack, src peerInfo, service string, res hopResult, traceID string, unready bool) {
+
+	if flags.WorkerRecords == "" {
+		return
+	}
+
+	rec := hopRecord{
+		V:          recordSchemaVersion,
+		Time:       time.Now().UTC(),
+		Src:        src,
+		Dst:        res.dst,
+		Service:    service,
+		Protocol:   flags.WorkerProtocol,
+		Status:     res.status,
+		OK:         res.err == nil && res.status < 400,
+		ErrorClass: errorClass(res.status, res.err),
+		Attempts:   res.attempts,
+		DurationMs: float64(res.duration) / float64(time.Millisecond),
+		TraceID:    traceID,
+	}
+	if res.err != nil {
+		rec.Error = res.err.Error()
+	}
+	rec.Expected = unready && !rec.OK
+	if info, ok := res.info.(httpInfo); ok {
+		rec.PhasesMs = info.Phases
+	}
+	records.write(rec)
+}
@@ -0,0 +1,135 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+// TestErrorClass
+//-----------------------------------------------------------------------------
+
+func TestErrorClass(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   string
+	}{
+		{name: "ok", status: 200, want: ""},
+		{name: "redirect", status: 302, want: ""},
+		{name: "status", status: 503, want: ErrorClassStatus},
+		{name: "canceled", err: fmt.Errorf("get: %w", context.Canceled), want: ErrorClassCanceled},
+		{name: "deadline", err: fmt.Errorf("get: %w", context.DeadlineExceeded), want: ErrorClassTimeout},
+		{name: "dns", err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "peer.n1"}}, want: ErrorClassDNS},
+		{name: "refused", err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, want: ErrorClassRefused},
+		{name: "reset", err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, want: ErrorClassReset},
+		{name: "broken pipe", err: &net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)}, want: ErrorClassReset},
+		{name: "tls record", err: fmt.Errorf("get: %w", tls.RecordHeaderError{Msg: "not a tls handshake"}), want: ErrorClassTLS},
+		{name: "tls alert", err: fmt.Errorf("get: %w", tls.AlertError(42)), want: ErrorClassTLS},
+		{name: "tls verification", err: &tls.CertificateVerificationError{Err: errors.New("unknown authority")}, want: ErrorClassTLS},
+		{name: "eof", err: fmt.Errorf("get: %w", io.EOF), want: ErrorClassEOF},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: ErrorClassEOF},
+		{name: "net timeout", err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, want: ErrorClassTimeout},
+		{name: "other", err: errors.New("boom"), want: ErrorClassOther},
+		{name: "error with status", status: 200, err: errors.New("boom"), want: ErrorClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorClass(tt.status, tt.err); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestRecordSinkRotate writes one record per file and checks which records
+// every file holds.
+//-----------------------------------------------------------------------------
+
+func TestRecordSinkRotate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		maxFiles int
+		writes   int
+		want     map[string][]string
+	}{
+		{name: "no rotation", maxFiles: 2, writes: 1, want: map[string][]string{"": {"s1"}, ".1": nil}},
+		{name: "rotated", maxFiles: 2, writes: 2, want: map[string][]string{"": {"s2"}, ".1": {"s1"}, ".2": nil}},
+		{name: "oldest dropped", maxFiles: 2, writes: 4, want: map[string][]string{"": {"s4"}, ".1": {"s3"}, ".2": {"s2"}, ".3": nil}},
+		{name: "no rotated files", maxFiles: 0, writes: 3, want: map[string][]string{"": {"s3"}, ".1": nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hops.jsonl")
+			s := &recordSink{path: path, maxSize: 1, maxFiles: tt.maxFiles}
+			if err := s.open(); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= tt.writes; i++ {
+				s.write(hopRecord{V: recordSchemaVersion, Service: fmt.Sprintf("s%d", i)})
+			}
+			if err := s.file.Close(); err != nil {
+				t.Fatal(err)
+			}
+			for suffix, want := range tt.want {
+				if got := readRecordServices(t, path+suffix); !slices.Equal(got, want) {
+					t.Errorf("%s holds %v, want %v", "hops.jsonl"+suffix, got, want)
+				}
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// readRecordServices returns the services of the records in a file, nil if
+// it does not exist.
+//-----------------------------------------------------------------------------
+
+func readRecordServices(t *testing.T, path string) []string {
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var services []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec hopRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		services = append(services, rec.Service)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return services
+}
@@ -0,0 +1,199 @@
+package worker
+
+import (
+
+	// Stdlib
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+//-----------------------------------------------------------------------------
+// Peer registry
+//
+// The registry holds the destinations last fetched from the informer. Readers
+// get an immutable snapshot, so the poller can publish a new list while the
+// scheduler and the chain forwarder are iterating over the previous one. Every
+// update that changes the list is diffed against the previous snapshot and
+// the subscribers are notified, so that the scheduler starts lanes for new
+// peers right away instead of on its next pass.
+//-----------------------------------------------------------------------------
+
+var peers = newPeerRegistry()
+
+//-----------------------------------------------------------------------------
+// peerRegistry publishes atomic snapshots of the destination list
+//-----------------------------------------------------------------------------
+
+type peerRegistry struct {
+	current    atomic.Pointer[peerSet]
+	synced     atomic.Bool
+	generation atomic.Uint64
+
+	mu   sync.Mutex
+	subs []chan struct{}
+}
+
+//-----------------------------------------------------------------------------
+// peerSet is one published list: the destinations and those of them the
+// informer marked as having no ready endpoints, swapped in together.
+//-----------------------------------------------------------------------------
+
+type peerSet struct {
+	services []string
+	unready  map[string]bool
+}
+
+//-----------------------------------------------------------------------------
+// peerDiff is the change between two snapshots
+//-----------------------------------------------------------------------------
+
+type peerDiff struct {
+	added   []string
+	removed []string
+}
+
+func (d peerDiff) empty() bool {
+	return len(d.added) == 0 && len(d.removed) == 0
+}
+
+//-----------------------------------------------------------------------------
+// newPeerRegistry returns an empty registry
+//-----------------------------------------------------------------------------
+
+func newPeerRegistry() *peerRegistry {
+	r := &peerRegistry{}
+	r.current.Store(&peerSet{services: []string{}})
+	return r
+}
+
+//-----------------------------------------------------------------------------
+// snapshot returns the current destinations, in informer order. The slice
+// must not be modified.
+//-----------------------------------------------------------------------------
+
+func (r *peerRegistry) snapshot() []string {
+	return r.current.Load().services
+}
+
+//-----------------------------------------------------------------------------
+// readySnapshot returns the current destinations that have ready endpoints
+//-----------------------------------------------------------------------------
+
+func (r *peerRegistry) readySnapshot() []string {
+	set := r.current.Load()
+	var services []string
+	for _, service := range set.services {
+		if !set.unready[service] {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+//-----------------------------------------------------------------------------
+// fetched reports whether a list was ever published, even an empty one
+//-----------------------------------------------------------------------------
+
+func (r *peerRegistry) fetched() bool {
+	return r.synced.Load()
+}
+
+//-----------------------------------------------------------------------------
+// update publishes a new destination list, along with the destinations
+// without ready endpoints, and returns how it differs from the previous one.
+// Subscribers are notified when peers were added or removed, or when the
+// order changed.
+//-----------------------------------------------------------------------------
+
+func (r *peerRegistry) update(services, unready []string) peerDiff {
+
+	next := &peerSet{services: slices.Clone(services), unready: make(map[string]bool, len(unready))}
+	for _, service := range unready {
+		next.unready[service] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.synced.Store(true)
+
+	// Diff against the previous snapshot
+	prev := r.snapshot()
+	diff := diffPeers(prev, next.services)
+	r.current.Store(next)
+	if diff.empty() && slices.Equal(prev, next.services) {
+		return diff
+	}
+
+	// Notify, coalescing with pending notifications
+	for _, ch := range r.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return diff
+}
+
+//-----------------------------------------------------------------------------
+// advance records the informer generation of the list in effect and reports
+// whether it differs from the previous one.
+//-----------------------------------------------------------------------------
+
+func (r *peerRegistry) advance(generation uint64) bool {
+	return r.generation.Swap(generation) != generation
+}
+
+//-----------------------------------------------------------------------------
+// isUnready tells whether the informer marked a destination as having no
+// ready endpoints, so that failures to reach it can be told apart as
+// expected.
+//-----------------------------------------------------------------------------
+
+func (r *peerRegistry) isUnready(service string) bool {
+	return r.current.Load().unready[service]
+}
+
+//-----------------------------------------------------------------------------
+// subscribe returns a channel that receives a value after the destination
+// list changes. Changes made while a notification is pending are coalesced
+// into it, so subscribers should read the snapshot once notified.
+//-----------------------------------------------------------------------------
+
+func (r *peerRegistry) subscribe() <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subs = append(r.subs, ch)
+	return ch
+}
+
+//-----------------------------------------------------------------------------
+// diffPeers returns the peers in next but not in prev, and the other way
+// around, each in the order of its list.
+//-----------------------------------------------------------------------------
+
+func diffPeers(prev, next []string) peerDiff {
+
+	in := func(list []string) map[string]bool {
+		set := make(map[string]bool, len(list))
+		for _, service := range list {
+			set[service] = true
+		}
+		return set
+	}
+	inPrev, inNext := in(prev), in(next)
+
+	var diff peerDiff
+	for _, service := range next {
+		if !inPrev[service] {
+			diff.added = append(diff.added, service)
+		}
+	}
+	for _, service := range prev {
+		if !inNext[service] {
+			diff.removed = append(diff.removed, service)
+		}
+	}
+	return diff
+}
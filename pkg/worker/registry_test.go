@@ -0,0 +1,209 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+//-----------------------------------------------------------------------------
+// TestPeerRegistryUpdate
+//-----------------------------------------------------------------------------
+
+func TestPeerRegistryUpdate(t *testing.T) {
+
+	r := newPeerRegistry()
+	steps := []struct {
+		services []string
+		unready  []string
+		added    []string
+		removed  []string
+		notified bool
+	}{
+		{services: []string{"a:80", "b:80"}, added: []string{"a:80", "b:80"}, notified: true},
+		{services: []string{"a:80", "b:80"}},
+		{services: []string{"a:80", "b:80"}, unready: []string{"b:80"}},
+		{services: []string{"b:80", "a:80"}, notified: true},
+		{services: []string{"b:80", "c:80"}, added: []string{"c:80"}, removed: []string{"a:80"}, notified: true},
+		{services: nil, removed: []string{"b:80", "c:80"}, notified: true},
+	}
+
+	changes := r.subscribe()
+	for i, step := range steps {
+		diff := r.update(step.services, step.unready)
+		if !slices.Equal(diff.added, step.added) || !slices.Equal(diff.removed, step.removed) {
+			t.Errorf("step %d: got added %v removed %v, want added %v removed %v", i, diff.added, diff.removed, step.added, step.removed)
+		}
+		if got := r.snapshot(); !slices.Equal(got, step.services) {
+			t.Errorf("step %d: got snapshot %v, want %v", i, got, step.services)
+		}
+		if got, want := r.readySnapshot(), slices.DeleteFunc(slices.Clone(step.services), func(s string) bool {
+			return slices.Contains(step.unready, s)
+		}); !slices.Equal(got, want) {
+			t.Errorf("step %d: got ready snapshot %v, want %v", i, got, want)
+		}
+		select {
+		case <-changes:
+			if !step.notified {
+				t.Errorf("step %d: unexpected notification", i)
+			}
+		default:
+			if step.notified {
+				t.Errorf("step %d: missing notification", i)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestPeerRegistrySnapshotIsolation
+//-----------------------------------------------------------------------------
+
+func TestPeerRegistrySnapshotIsolation(t *testing.T) {
+
+	r := newPeerRegistry()
+	services := []string{"a:80", "b:80"}
+	r.update(services, nil)
+	snap := r.snapshot()
+
+	// Neither the caller's slice nor later updates change a snapshot
+	services[0] = "x:80"
+	r.update([]string{"c:80"}, nil)
+	if !slices.Equal(snap, []string{"a:80", "b:80"}) {
+		t.Errorf("snapshot changed to %v", snap)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestPeerRegistryConcurrent exercises the registry from many goroutines, so
+// that running it with -race catches unsynchronized access.
+//-----------------------------------------------------------------------------
+
+func TestPeerRegistryConcurrent(t *testing.T) {
+
+	r := newPeerRegistry()
+	changes := r.subscribe()
+	done := make(chan struct{})
+
+	// Writers
+	var writers sync.WaitGroup
+	for w := range 4 {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for i := range 200 {
+				r.update([]string{fmt.Sprintf("w%d-%d:80", w, i%7), "shared:80"}, nil)
+			}
+		}()
+	}
+
+	// Readers
+	var readers sync.WaitGroup
+	for range 4 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, service := range r.snapshot() {
+					if service == "" {
+						t.Error("empty service in snapshot")
+					}
+				}
+			}
+		}()
+	}
+
+	// A subscriber
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-changes:
+				_ = len(r.snapshot())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	if got := len(r.snapshot()); got != 2 {
+		t.Errorf("got %d services, want 2", got)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestSchedulerFollowsRegistry checks that a peer added to the registry gets
+// a lane as soon as the change is notified.
+//-----------------------------------------------------------------------------
+
+func TestSchedulerFollowsRegistry(t *testing.T) {
+
+	r := newPeerRegistry()
+	changes := r.subscribe()
+
+	hit := make(chan string, 16)
+	aborted, abort := context.WithCancel(context.Background())
+	defer abort()
+	s := &scheduler{
+		mode:     RateModePerDestination,
+		interval: 10 * time.Millisecond,
+		profile:  constantProfile{},
+		strategy: &roundRobinStrategy{},
+		start:    time.Now(),
+		hop: func(_ context.Context, service string) {
+			select {
+			case hit <- service:
+			default:
+			}
+		},
+		sem:     make(chan struct{}, 1),
+		aborted: aborted,
+		abort:   abort,
+		lanes:   map[string]*lane{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		s.wait(time.Second)
+	}()
+
+	// Sync on every notification, like the client does
+	go func() {
+		for {
+			select {
+			case <-changes:
+				s.sync(ctx, r.snapshot())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	r.update([]string{"new:80"}, nil)
+	select {
+	case service := <-hit:
+		if service != "new:80" {
+			t.Errorf("got request to %q, want new:80", service)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no request to the new peer")
+	}
+}
@@ -0,0 +1,244 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	// Community
+	"github.com/prometheus/client_golang/prometheus"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Attempts
+//
+// A hop is one logical request, and the hop metrics describe it as a whole:
+// its final outcome and its latency including retries. Every attempt made
+// for it is recorded on its own in the attempt metrics, labelled by kind
+// (first, retry or hedge), and carries its number in the X-K-Swarm-Attempt
+// header (x-k-swarm-attempt metadata for gRPC). Retries done by the worker
+// therefore show up as extra attempts with distinct numbers, while retries
+// done by the mesh repeat the same number.
+//-----------------------------------------------------------------------------
+
+const (
+	attemptHeader = "X-K-Swarm-Attempt"
+
+	attemptFirst = "first"
+	attemptRetry = "retry"
+	attemptHedge = "hedge"
+)
+
+// attemptLabels extend hopLabels with the kind of attempt
+var attemptLabels = append(append([]string{}, hopLabels...), "kind")
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+var (
+	attemptRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "attempts_total",
+		Help:      "Number of attempts made by the worker, including retries and hedges. Hedges cancelled because another attempt won have status_class canceled.",
+	}, attemptLabels)
+
+	attemptDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "attempt_duration_seconds",
+		Help:      "Latency of every attempt made by the worker.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, attemptLabels)
+)
+
+func init() {
+	registry.MustRegister(attemptRequests, attemptDuration)
+}
+
+//-----------------------------------------------------------------------------
+// attemptKey carries the attempt number to the protocol call
+//-----------------------------------------------------------------------------
+
+type attemptKey struct{}
+
+func attemptFrom(ctx context.Context) int {
+	n, _ := ctx.Value(attemptKey{}).(int)
+	return n
+}
+
+//-----------------------------------------------------------------------------
+// validateRetries checks the retry flags
+//-----------------------------------------------------------------------------
+
+func validateRetries(flags *common.FlagPack) error {
+	if flags.WorkerRequestTimeout < 0 || flags.WorkerHedgeDelay < 0 {
+		return fmt.Errorf("request timeout and hedge delay must not be negative")
+	}
+	if flags.WorkerRetries < 0 {
+		return fmt.Errorf("retries must not be negative, got %d", flags.WorkerRetries)
+	}
+	if flags.WorkerRetries > 0 && (flags.WorkerRetryBackoff <= 0 || flags.WorkerRetryMaxBackoff < flags.WorkerRetryBackoff) {
+		return fmt.Errorf("retry backoff must be positive and not above the max backoff")
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// call makes one logical request to a peer: up to 1+retries rounds, each of
+// them optionally hedged, with exponential backoff and jitter in between.
+// The result is the one of the last round, timed from the very start.
+//-----------------------------------------------------------------------------
+
+func call(ctx context.Context, flags *common.FlagPack, service string) hopResult {
+
+	start := time.Now()
+	n := 0
+	for round := 0; ; round++ {
+
+		// Make a round
+		kind := attemptFirst
+		if round > 0 {
+			kind = attemptRetry
+		}
+		res := hedged(ctx, flags, service, kind, &n)
+
+		// Done?
+		if !retryable(res) || round == flags.WorkerRetries || ctx.Err() != nil {
+			res.duration = time.Since(start)
+			res.attempts = n
+			return res
+		}
+
+		// Back off
+		timer := time.NewTimer(backoff(flags, round))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// hedged makes one attempt and, if it has not completed after the hedge
+// delay, a second one in parallel. The first attempt that is not retryable
+// wins and the other one is cancelled.
+//-----------------------------------------------------------------------------
+
+func hedged(ctx context.Context, flags *common.FlagPack, service, kind string, n *int) hopResult {
+
+	// Plain attempt
+	if flags.WorkerHedgeDelay <= 0 {
+		*n++
+		return attempt(ctx, flags, service, kind, *n)
+	}
+
+	// Race the attempts
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hopResult, 2)
+	launch := func(kind string) {
+		*n++
+		go func(n int) { results <- attempt(hctx, flags, service, kind, n) }(*n)
+	}
+	launch(kind)
+	pending := 1
+
+	// Hedge if the first attempt is slow
+	timer := time.NewTimer(flags.WorkerHedgeDelay)
+	defer timer.Stop()
+	var res hopResult
+	for {
+		select {
+		case <-timer.C:
+			launch(attemptHedge)
+			pending++
+			continue
+		case res = <-results:
+			pending--
+		}
+		if !retryable(res) || pending == 0 {
+			return res
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// attempt makes a single call to a peer within the request timeout and
+// records it in the attempt metrics.
+//-----------------------------------------------------------------------------
+
+func attempt(ctx context.Context, flags *common.FlagPack, service, kind string, n int) hopResult {
+
+	// Bound the attempt
+	actx := context.WithValue(ctx, attemptKey{}, n)
+	if timeout := requestTimeout(flags, service); timeout > 0 {
+		var cancel context.CancelFunc
+		actx, cancel = context.WithTimeout(actx, timeout)
+		defer cancel()
+	}
+
+	// Call the peer
+	res := protocols[flags.WorkerProtocol].call(actx, flags, service)
+
+	// Record the attempt. Hedges that lost the race are cancelled by us.
+	class := statusClass(res.status, res.err)
+	if errors.Is(res.err, context.Canceled) && ctx.Err() != nil {
+		class = "canceled"
+	}
+	labels := peerLabels(localPeer(), res.dst, service)
+	labels["status_class"] = class
+	labels["kind"] = kind
+	attemptRequests.With(labels).Inc()
+	attemptDuration.With(labels).Observe(res.duration.Seconds())
+	if retryable(res) {
+		log.V(1).Info("attempt failed", "service", service, "attempt", n, "kind", kind, "status", res.status, "error", fmt.Sprint(res.err))
+	}
+
+	return res
+}
+
+//-----------------------------------------------------------------------------
+// requestTimeout returns the timeout of a single call to a service, the
+// scenario taking precedence over the flags. Zero means none.
+//-----------------------------------------------------------------------------
+
+func requestTimeout(flags *common.FlagPack, service string) time.Duration {
+	if t := scenarios.load().traffic(service).Timeout; t > 0 {
+		return time.Duration(t)
+	}
+	return flags.WorkerRequestTimeout
+}
+
+//-----------------------------------------------------------------------------
+// retryable reports whether a result is worth another attempt: transport
+// errors, 5xx and 429.
+//-----------------------------------------------------------------------------
+
+func retryable(res hopResult) bool {
+	return res.err != nil || res.status >= 500 || res.status == http.StatusTooManyRequests
+}
+
+//-----------------------------------------------------------------------------
+// backoff returns the wait before the retry following the given round:
+// exponential from --worker-retry-backoff, capped at --worker-retry-max-backoff,
+// with equal jitter so that retries from many workers spread out.
+//-----------------------------------------------------------------------------
+
+func backoff(flags *common.FlagPack, round int) time.Duration {
+	d := flags.WorkerRetryBackoff << min(round, 30)
+	if d <= 0 || d > flags.WorkerRetryMaxBackoff {
+		d = flags.WorkerRetryMaxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
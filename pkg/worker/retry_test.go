@@ -0,0 +1,204 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// TestValidateRetries
+//-----------------------------------------------------------------------------
+
+func TestValidateRetries(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		flags common.FlagPack
+		err   bool
+	}{
+		{name: "no retries", flags: common.FlagPack{}},
+		{name: "retries", flags: common.FlagPack{WorkerRetries: 2, WorkerRetryBackoff: time.Millisecond, WorkerRetryMaxBackoff: time.Second}},
+		{name: "negative retries", flags: common.FlagPack{WorkerRetries: -1}, err: true},
+		{name: "retries without backoff", flags: common.FlagPack{WorkerRetries: 1, WorkerRetryMaxBackoff: time.Second}, err: true},
+		{name: "backoff above max", flags: common.FlagPack{WorkerRetries: 1, WorkerRetryBackoff: time.Second, WorkerRetryMaxBackoff: time.Millisecond}, err: true},
+		{name: "negative timeout", flags: common.FlagPack{WorkerRequestTimeout: -time.Second}, err: true},
+		{name: "negative hedge delay", flags: common.FlagPack{WorkerHedgeDelay: -time.Second}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRetries(&tt.flags); (err != nil) != tt.err {
+				t.Errorf("got error %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestRetryable
+//-----------------------------------------------------------------------------
+
+func TestRetryable(t *testing.T) {
+
+	tests := []struct {
+		name string
+		res  hopResult
+		want bool
+	}{
+		{name: "ok", res: hopResult{status: http.StatusOK}},
+		{name: "not found", res: hopResult{status: http.StatusNotFound}},
+		{name: "too many requests", res: hopResult{status: http.StatusTooManyRequests}, want: true},
+		{name: "unavailable", res: hopResult{status: http.StatusServiceUnavailable}, want: true},
+		{name: "transport error", res: hopResult{err: errors.New("connection refused")}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.res); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestBackoff checks the exponential growth, the cap and the jitter bounds
+//-----------------------------------------------------------------------------
+
+func TestBackoff(t *testing.T) {
+
+	flags := &common.FlagPack{WorkerRetryBackoff: 100 * time.Millisecond, WorkerRetryMaxBackoff: time.Second}
+
+	tests := []struct {
+		name  string
+		round int
+		max   time.Duration
+	}{
+		{name: "first", round: 0, max: 100 * time.Millisecond},
+		{name: "second", round: 1, max: 200 * time.Millisecond},
+		{name: "capped", round: 5, max: time.Second},
+		{name: "overflow", round: 100, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				if d := backoff(flags, tt.round); d < tt.max/2 || d > tt.max {
+					t.Fatalf("got %s, want within [%s, %s]", d, tt.max/2, tt.max)
+				}
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestCall runs calls against a fake protocol answering every attempt with
+// a given status after a given delay.
+//-----------------------------------------------------------------------------
+
+func TestCall(t *testing.T) {
+
+	type answer struct {
+		status int
+		delay  time.Duration
+	}
+
+	tests := []struct {
+		name     string
+		flags    common.FlagPack
+		answers  []answer
+		status   int
+		attempts int
+	}{
+		{
+			name:     "success",
+			answers:  []answer{{status: http.StatusOK}},
+			status:   http.StatusOK,
+			attempts: 1,
+		},
+		{
+			name:     "client error is final",
+			flags:    common.FlagPack{WorkerRetries: 3, WorkerRetryBackoff: time.Millisecond, WorkerRetryMaxBackoff: time.Millisecond},
+			answers:  []answer{{status: http.StatusNotFound}},
+			status:   http.StatusNotFound,
+			attempts: 1,
+		},
+		{
+			name:     "retried until success",
+			flags:    common.FlagPack{WorkerRetries: 3, WorkerRetryBackoff: time.Millisecond, WorkerRetryMaxBackoff: time.Millisecond},
+			answers:  []answer{{status: http.StatusServiceUnavailable}, {status: http.StatusTooManyRequests}, {status: http.StatusOK}},
+			status:   http.StatusOK,
+			attempts: 3,
+		},
+		{
+			name:     "retries exhausted",
+			flags:    common.FlagPack{WorkerRetries: 2, WorkerRetryBackoff: time.Millisecond, WorkerRetryMaxBackoff: time.Millisecond},
+			answers:  []answer{{status: http.StatusBadGateway}, {status: http.StatusBadGateway}, {status: http.StatusBadGateway}, {status: http.StatusOK}},
+			status:   http.StatusBadGateway,
+			attempts: 3,
+		},
+		{
+			name:     "hedge wins",
+			flags:    common.FlagPack{WorkerHedgeDelay: 10 * time.Millisecond},
+			answers:  []answer{{status: http.StatusOK, delay: time.Second}, {status: http.StatusCreated}},
+			status:   http.StatusCreated,
+			attempts: 2,
+		},
+		{
+			name:     "no hedge when fast",
+			flags:    common.FlagPack{WorkerHedgeDelay: time.Second},
+			answers:  []answer{{status: http.StatusOK}},
+			status:   http.StatusOK,
+			attempts: 1,
+		},
+		{
+			name:     "timed out",
+			flags:    common.FlagPack{WorkerRequestTimeout: 10 * time.Millisecond},
+			answers:  []answer{{status: http.StatusOK, delay: time.Second}},
+			attempts: 1,
+		},
+	}
+
+	defer delete(protocols, "test")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Answer by attempt number
+			protocols["test"] = protocol{call: func(ctx context.Context, _ *common.FlagPack, _ string) hopResult {
+				a := tt.answers[min(attemptFrom(ctx), len(tt.answers))-1]
+				select {
+				case <-time.After(a.delay):
+					return hopResult{status: a.status}
+				case <-ctx.Done():
+					return hopResult{err: ctx.Err()}
+				}
+			}}
+
+			flags := tt.flags
+			flags.WorkerProtocol = "test"
+			res := call(context.Background(), &flags, "a.ns:80")
+			if res.status != tt.status {
+				t.Errorf("got status %d, want %d", res.status, tt.status)
+			}
+			if tt.status == 0 && res.err == nil {
+				t.Error("got no error, want one")
+			}
+			if res.attempts != tt.attempts {
+				t.Errorf("got %d attempts, want %d", res.attempts, tt.attempts)
+			}
+		})
+	}
+}
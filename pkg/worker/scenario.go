@@ -0,0 +1,361 @@
+package worker
+
+import (
+
+	// Stdlib
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	// Community
+	"sigs.k8s.io/yaml"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Traffic scenarios
+//
+// A scenario describes the worker's traffic declaratively: which of the
+// informer's destinations to call and, per destination, the rate, the HTTP
+// method, path, payload size and headers, and the request timeout. It is a
+// YAML or JSON document read from --worker-scenario, either a file (such as
+// a mounted ConfigMap) or an http(s) URL serving it centrally, and reloaded
+// every --worker-scenario-reload-interval. A scenario that fails to load or
+// validate is logged and the previous one stays in place.
+//
+//	include: ["swarm-*"]        # match the address, host or namespace
+//	exclude: ["swarm-sidecar-n3"]
+//	defaults:
+//	  rate: 2                   # per destination, per-destination mode only
+//	  timeout: 1s
+//	destinations:
+//	- match: "peer.swarm-sidecar-n1*"
+//	  method: POST
+//	  path: /data
+//	  payloadBytes: 4096
+//	  headers: {X-Experiment: big-posts}
+//
+// The first destination entry that matches a service overrides the defaults,
+// its headers merged over theirs. Methods, paths, payloads and headers only
+// apply to the http protocol.
+//-----------------------------------------------------------------------------
+
+var scenarios = &scenarioStore{changed: make(chan struct{}, 1)}
+
+//-----------------------------------------------------------------------------
+// scenario is the document format
+//-----------------------------------------------------------------------------
+
+type scenario struct {
+	Include      []string              `json:"include,omitempty"`
+	Exclude      []string              `json:"exclude,omitempty"`
+	Defaults     scenarioTraffic       `json:"defaults,omitempty"`
+	Destinations []scenarioDestination `json:"destinations,omitempty"`
+}
+
+type scenarioDestination struct {
+	Match string `json:"match"`
+	scenarioTraffic
+}
+
+//-----------------------------------------------------------------------------
+// scenarioTraffic is the traffic sent to a destination. Zero values leave
+// the worker flags in charge.
+//-----------------------------------------------------------------------------
+
+type scenarioTraffic struct {
+	Rate         float64           `json:"rate,omitempty"`
+	Method       string            `json:"method,omitempty"`
+	Path         string            `json:"path,omitempty"`
+	PayloadBytes int               `json:"payloadBytes,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Timeout      scenarioDuration  `json:"timeout,omitempty"`
+}
+
+//-----------------------------------------------------------------------------
+// scenarioDuration reads durations written as "1s" or "250ms"
+//-----------------------------------------------------------------------------
+
+type scenarioDuration time.Duration
+
+func (d *scenarioDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations must be strings such as \"1s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = scenarioDuration(v)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// parseScenario decodes and validates a scenario document
+//-----------------------------------------------------------------------------
+
+func parseScenario(data []byte) (*scenario, error) {
+
+	// Decode
+	var sc scenario
+	if err := yaml.UnmarshalStrict(data, &sc); err != nil {
+		return nil, err
+	}
+
+	// Validate the patterns
+	patterns := slices.Concat(sc.Include, sc.Exclude)
+	for _, d := range sc.Destinations {
+		if d.Match == "" {
+			return nil, fmt.Errorf("destination entries need a match pattern")
+		}
+		patterns = append(patterns, d.Match)
+	}
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+	}
+
+	// Validate the traffic
+	traffic := []scenarioTraffic{sc.Defaults}
+	for _, d := range sc.Destinations {
+		traffic = append(traffic, d.scenarioTraffic)
+	}
+	for _, t := range traffic {
+		switch {
+		case t.Rate < 0:
+			return nil, fmt.Errorf("rate must not be negative, got %v", t.Rate)
+		case t.PayloadBytes < 0:
+			return nil, fmt.Errorf("payload bytes must not be negative, got %d", t.PayloadBytes)
+		case t.Timeout < 0:
+			return nil, fmt.Errorf("timeout must not be negative, got %s", time.Duration(t.Timeout))
+		case t.Path != "" && !strings.HasPrefix(t.Path, "/"):
+			return nil, fmt.Errorf("path must start with /, got %q", t.Path)
+		case strings.ContainsAny(t.Method, " \t\r\n"):
+			return nil, fmt.Errorf("bad method %q", t.Method)
+		}
+	}
+
+	return &sc, nil
+}
+
+//-----------------------------------------------------------------------------
+// matches reports whether a pattern matches the service's address, host or
+// namespace.
+//-----------------------------------------------------------------------------
+
+func matches(pattern, service string) bool {
+	addr, _ := splitDestination(service)
+	host, _, _ := strings.Cut(addr, ":")
+	for _, key := range []string{service, addr, host, serviceNamespace(service)} {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+// filter returns the services the scenario includes, in their order
+//-----------------------------------------------------------------------------
+
+func (sc *scenario) filter(services []string) []string {
+
+	if sc == nil || (len(sc.Include) == 0 && len(sc.Exclude) == 0) {
+		return services
+	}
+
+	matchAny := func(patterns []string, service string) bool {
+		for _, p := range patterns {
+			if matches(p, service) {
+				return true
+			}
+		}
+		return false
+	}
+
+	out := make([]string, 0, len(services))
+	for _, service := range services {
+		if len(sc.Include) > 0 && !matchAny(sc.Include, service) {
+			continue
+		}
+		if matchAny(sc.Exclude, service) {
+			continue
+		}
+		out = append(out, service)
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
+// traffic returns the traffic settings of a service
+//-----------------------------------------------------------------------------
+
+func (sc *scenario) traffic(service string) scenarioTraffic {
+
+	if sc == nil {
+		return scenarioTraffic{}
+	}
+
+	t := sc.Defaults
+	for _, d := range sc.Destinations {
+		if !matches(d.Match, service) {
+			continue
+		}
+		o := d.scenarioTraffic
+		if o.Rate > 0 {
+			t.Rate = o.Rate
+		}
+		if o.Method != "" {
+			t.Method = o.Method
+		}
+		if o.Path != "" {
+			t.Path = o.Path
+		}
+		if o.PayloadBytes > 0 {
+			t.PayloadBytes = o.PayloadBytes
+		}
+		if o.Timeout > 0 {
+			t.Timeout = o.Timeout
+		}
+		if len(o.Headers) > 0 {
+			headers := maps.Clone(t.Headers)
+			if headers == nil {
+				headers = map[string]string{}
+			}
+			maps.Copy(headers, o.Headers)
+			t.Headers = headers
+		}
+		break
+	}
+	return t
+}
+
+//-----------------------------------------------------------------------------
+// scenarioStore holds the scenario in effect, nil when there is none. A
+// value is sent on changed, coalesced, whenever a new scenario is loaded.
+//-----------------------------------------------------------------------------
+
+type scenarioStore struct {
+	current atomic.Pointer[scenario]
+	changed chan struct{}
+}
+
+func (s *scenarioStore) load() *scenario {
+	return s.current.Load()
+}
+
+func (s *scenarioStore) store(sc *scenario) {
+	s.current.Store(sc)
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+//-----------------------------------------------------------------------------
+// setupScenario loads the scenario, if any, and keeps reloading it until the
+// context is done. Only the first load is fatal.
+//-----------------------------------------------------------------------------
+
+func setupScenario(ctx context.Context, flags *common.FlagPack) error {
+
+	// Scenarios are optional
+	src := flags.WorkerScenario
+	if src == "" {
+		return nil
+	}
+	if flags.WorkerScenarioReloadInterval <= 0 {
+		return fmt.Errorf("scenario reload interval must be positive, got %s", flags.WorkerScenarioReloadInterval)
+	}
+
+	// First load
+	data, err := readScenario(ctx, src)
+	if err != nil {
+		return err
+	}
+	sc, err := parseScenario(data)
+	if err != nil {
+		return fmt.Errorf("invalid scenario %s: %w", src, err)
+	}
+	scenarios.store(sc)
+	log.Info("scenario loaded", "source", src)
+
+	// Reload on change
+	go func() {
+		ticker := time.NewTicker(flags.WorkerScenarioReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			next, err := readScenario(ctx, src)
+			if err != nil {
+				log.Error(err, "failed to read scenario", "source", src)
+				continue
+			}
+			if bytes.Equal(next, data) {
+				continue
+			}
+			sc, err := parseScenario(next)
+			if err != nil {
+				log.Error(err, "invalid scenario, keeping the previous one", "source", src)
+				data = next
+				continue
+			}
+			data = next
+			scenarios.store(sc)
+			log.Info("scenario reloaded", "source", src)
+		}
+	}()
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// readScenario reads a scenario from a file or an http(s) URL
+//-----------------------------------------------------------------------------
+
+func readScenario(ctx context.Context, src string) ([]byte, error) {
+
+	// Files
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.ReadFile(src)
+	}
+
+	// URLs
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Error(err, "failed to close response body")
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned non-200 status code: %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
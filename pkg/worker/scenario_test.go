@@ -0,0 +1,160 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+//-----------------------------------------------------------------------------
+// TestParseScenario
+//-----------------------------------------------------------------------------
+
+func TestParseScenario(t *testing.T) {
+
+	tests := []struct {
+		name string
+		doc  string
+		ok   bool
+	}{
+		{name: "empty", doc: ``, ok: true},
+		{name: "yaml", doc: "include: [\"swarm-*\"]\ndefaults:\n  rate: 2\n  timeout: 1s\ndestinations:\n- match: \"peer.*\"\n  method: POST\n  path: /data\n", ok: true},
+		{name: "json", doc: `{"exclude": ["swarm-n3"], "defaults": {"payloadBytes": 4096}}`, ok: true},
+		{name: "unknown field", doc: `{"rates": 2}`},
+		{name: "bad pattern", doc: `{"include": ["["]}`},
+		{name: "missing match", doc: `{"destinations": [{"rate": 1}]}`},
+		{name: "negative rate", doc: `{"defaults": {"rate": -1}}`},
+		{name: "negative payload", doc: `{"destinations": [{"match": "*", "payloadBytes": -1}]}`},
+		{name: "negative timeout", doc: `{"defaults": {"timeout": "-1s"}}`},
+		{name: "numeric timeout", doc: `{"defaults": {"timeout": 1}}`},
+		{name: "relative path", doc: `{"defaults": {"path": "data"}}`},
+		{name: "bad method", doc: `{"defaults": {"method": "GET /"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseScenario([]byte(tt.doc)); (err == nil) != tt.ok {
+				t.Errorf("got error %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestScenarioFilter
+//-----------------------------------------------------------------------------
+
+func TestScenarioFilter(t *testing.T) {
+
+	services := []string{
+		"peer.swarm-n1:80",
+		"peer.swarm-n2:80",
+		"peer.swarm-n3:80@east",
+		"other.default:80",
+	}
+
+	tests := []struct {
+		name string
+		sc   *scenario
+		want []string
+	}{
+		{name: "nil", sc: nil, want: services},
+		{name: "no patterns", sc: &scenario{}, want: services},
+		{name: "include namespace", sc: &scenario{Include: []string{"swarm-*"}}, want: services[:3]},
+		{name: "include host", sc: &scenario{Include: []string{"other.*"}}, want: services[3:]},
+		{name: "exclude", sc: &scenario{Exclude: []string{"swarm-n2"}}, want: []string{services[0], services[2], services[3]}},
+		{name: "include and exclude", sc: &scenario{Include: []string{"swarm-*"}, Exclude: []string{"*@east"}}, want: services[:2]},
+		{name: "exclude address", sc: &scenario{Exclude: []string{"peer.swarm-n3:80"}}, want: []string{services[0], services[1], services[3]}},
+		{name: "no match", sc: &scenario{Include: []string{"nothing"}}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sc.filter(services); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestScenarioTraffic
+//-----------------------------------------------------------------------------
+
+func TestScenarioTraffic(t *testing.T) {
+
+	sc := &scenario{
+		Defaults: scenarioTraffic{
+			Rate:    2,
+			Timeout: scenarioDuration(time.Second),
+			Headers: map[string]string{"X-A": "a", "X-B": "b"},
+		},
+		Destinations: []scenarioDestination{
+			{Match: "swarm-n1", scenarioTraffic: scenarioTraffic{Method: "POST", PayloadBytes: 4096, Headers: map[string]string{"X-B": "n1"}}},
+			{Match: "peer.*", scenarioTraffic: scenarioTraffic{Rate: 5, Path: "/slow", Timeout: scenarioDuration(3 * time.Second)}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		sc      *scenario
+		service string
+		want    scenarioTraffic
+	}{
+		{
+			name:    "nil",
+			service: "peer.swarm-n1:80",
+		},
+		{
+			name:    "first match wins and merges headers",
+			sc:      sc,
+			service: "peer.swarm-n1:80",
+			want: scenarioTraffic{
+				Rate:         2,
+				Method:       "POST",
+				PayloadBytes: 4096,
+				Timeout:      scenarioDuration(time.Second),
+				Headers:      map[string]string{"X-A": "a", "X-B": "n1"},
+			},
+		},
+		{
+			name:    "second match overrides",
+			sc:      sc,
+			service: "peer.swarm-n2:80@east",
+			want: scenarioTraffic{
+				Rate:    5,
+				Path:    "/slow",
+				Timeout: scenarioDuration(3 * time.Second),
+				Headers: map[string]string{"X-A": "a", "X-B": "b"},
+			},
+		},
+		{
+			name:    "defaults",
+			sc:      sc,
+			service: "other.default:80",
+			want:    sc.Defaults,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.sc.traffic(tt.service)
+			if got.Rate != tt.want.Rate || got.Method != tt.want.Method || got.Path != tt.want.Path ||
+				got.PayloadBytes != tt.want.PayloadBytes || got.Timeout != tt.want.Timeout || !maps.Equal(got.Headers, tt.want.Headers) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Merging headers leaves the defaults untouched
+	if sc.Defaults.Headers["X-B"] != "b" {
+		t.Errorf("defaults headers changed to %v", sc.Defaults.Headers)
+	}
+}
@@ -0,0 +1,363 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	// Community
+	"github.com/prometheus/client_golang/prometheus"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Rate modes
+//-----------------------------------------------------------------------------
+
+const (
+
+	// RateModePerDestination sends --worker-rate requests per second to every
+	// destination, independently of how many destinations there are.
+	RateModePerDestination = "per-destination"
+
+	// RateModePerWorker spreads --worker-rate requests per second across all
+	// destinations, so the worker's total output stays constant.
+	RateModePerWorker = "per-worker"
+)
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+var (
+	schedulerLanes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "scheduler_destinations",
+		Help:      "Number of destinations currently scheduled by the worker.",
+	})
+
+	schedulerSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "scheduler_skipped_total",
+		Help:      "Number of scheduled requests dropped because no destination was idle.",
+	})
+)
+
+func init() {
+	registry.MustRegister(schedulerLanes, schedulerSkipped)
+}
+
+//-----------------------------------------------------------------------------
+// scheduler paces requests to every destination. Each destination gets its
+// own lane (goroutine) with at most one request in flight, so a slow peer can
+// only ever hold up its own lane, while a shared semaphore caps the number of
+// requests in flight across all lanes.
+//-----------------------------------------------------------------------------
+
+type scheduler struct {
+	mode     string
+	interval time.Duration
+	profile  profile
+	strategy strategy
+	start    time.Time
+	hop      func(ctx context.Context, service string)
+	sem      chan struct{}
+	inFlight sync.WaitGroup
+	aborted  context.Context
+	abort    context.CancelFunc
+
+	mu       sync.Mutex
+	lanes    map[string]*lane
+	ring     []string
+	draining bool
+}
+
+//-----------------------------------------------------------------------------
+// lane is the per-destination worker of the scheduler
+//-----------------------------------------------------------------------------
+
+type lane struct {
+	service string
+	inbox   chan struct{}
+	cancel  context.CancelFunc
+}
+
+//-----------------------------------------------------------------------------
+// newScheduler returns a scheduler configured from the worker flags
+//-----------------------------------------------------------------------------
+
+func newScheduler(flags *common.FlagPack, hop func(ctx context.Context, service string)) (*scheduler, error) {
+
+	// Validate the mode
+	switch flags.WorkerRateMode {
+	case RateModePerDestination, RateModePerWorker:
+	default:
+		return nil, fmt.Errorf("unknown rate mode %q", flags.WorkerRateMode)
+	}
+
+	// Validate the concurrency
+	if flags.WorkerConcurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d", flags.WorkerConcurrency)
+	}
+
+	// Derive the interval from the rate, falling back to the legacy flag
+	interval := flags.WorkerRequestInterval
+	if flags.WorkerRate > 0 {
+		interval = time.Duration(float64(time.Second) / flags.WorkerRate)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("request interval must be positive, got %s", interval)
+	}
+
+	// Setup the traffic profile
+	p, err := newProfile(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup the destination strategy
+	st, err := newStrategy(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return the scheduler
+	aborted, abort := context.WithCancel(context.Background())
+	return &scheduler{
+		mode:     flags.WorkerRateMode,
+		interval: interval,
+		profile:  p,
+		strategy: st,
+		start:    time.Now(),
+		hop:      hop,
+		sem:      make(chan struct{}, flags.WorkerConcurrency),
+		aborted:  aborted,
+		abort:    abort,
+		lanes:    map[string]*lane{},
+	}, nil
+}
+
+//-----------------------------------------------------------------------------
+// sync starts a lane for every new service and stops the lanes of services
+// that are gone.
+//-----------------------------------------------------------------------------
+
+func (s *scheduler) sync(ctx context.Context, services []string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Start new lanes
+	wanted := make(map[string]bool, len(services))
+	for _, service := range services {
+		wanted[service] = true
+		if _, ok := s.lanes[service]; ok {
+			continue
+		}
+		laneCtx, cancel := context.WithCancel(ctx)
+		l := &lane{service: service, inbox: make(chan struct{}, 1), cancel: cancel}
+		s.lanes[service] = l
+		go s.runLane(laneCtx, l)
+	}
+
+	// Stop stale lanes
+	for service, l := range s.lanes {
+		if !wanted[service] {
+			l.cancel()
+			delete(s.lanes, service)
+		}
+	}
+
+	// Rebuild the dispatch ring in informer order
+	s.ring = s.ring[:0]
+	for _, service := range services {
+		if _, ok := s.lanes[service]; ok {
+			s.ring = append(s.ring, service)
+		}
+	}
+	s.strategy.update(s.ring)
+	schedulerLanes.Set(float64(len(s.lanes)))
+}
+
+//-----------------------------------------------------------------------------
+// run drives the per-worker dispatcher until the context is done. In
+// per-destination mode lanes pace themselves and run only waits.
+//-----------------------------------------------------------------------------
+
+func (s *scheduler) run(ctx context.Context) {
+
+	if s.mode != RateModePerWorker {
+		<-ctx.Done()
+		return
+	}
+
+	s.pace(ctx, s.interval, func() time.Duration { return s.interval }, s.dispatch)
+}
+
+//-----------------------------------------------------------------------------
+// pace calls fn on the schedule given by the profile, around the base
+// interval, until the context is done. Deadlines missed while fn was running
+// are dropped rather than replayed, so a slow fn lowers the achieved rate
+// instead of causing a burst.
+//-----------------------------------------------------------------------------
+
+func (s *scheduler) pace(ctx context.Context, first time.Duration, base func() time.Duration, fn func()) {
+
+	next := time.Now().Add(first)
+	timer := time.NewTimer(first)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+
+		fn()
+
+		now := time.Now()
+		next = next.Add(s.profile.next(base(), next, s.start))
+		if next.Before(now) {
+			next = now
+		}
+		timer.Reset(next.Sub(now))
+	}
+}
+
+//-----------------------------------------------------------------------------
+// dispatch hands one request to an idle lane picked by the destination
+// strategy. Busy lanes are skipped, with up to one pick per destination, so
+// a slow destination gives its turn away instead of delaying the rest.
+//-----------------------------------------------------------------------------
+
+func (s *scheduler) dispatch() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for range s.ring {
+		service := s.strategy.pick()
+		if service == "" {
+			break
+		}
+		select {
+		case s.lanes[service].inbox <- struct{}{}:
+			return
+		default:
+		}
+	}
+
+	if len(s.ring) > 0 {
+		schedulerSkipped.Inc()
+	}
+}
+
+//-----------------------------------------------------------------------------
+// runLane sends requests to a single destination until the lane is stopped
+//-----------------------------------------------------------------------------
+
+func (s *scheduler) runLane(ctx context.Context, l *lane) {
+
+	// Per-destination lanes pace themselves, at the scenario's rate for
+	// the destination if it sets one. The first request is spread over one
+	// interval so that lanes created together don't fire in lockstep.
+	if s.mode == RateModePerDestination {
+		base := func() time.Duration {
+			if r := scenarios.load().traffic(l.service).Rate; r > 0 {
+				return max(time.Duration(float64(time.Second)/r), time.Nanosecond)
+			}
+			return s.interval
+		}
+		s.pace(ctx, rand.N(base()), base, func() { s.send(ctx, l.service) })
+		return
+	}
+
+	// Per-worker lanes are fed by the dispatcher
+	for {
+		select {
+		case <-l.inbox:
+			s.send(ctx, l.service)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// send makes one request once a concurrency slot is free. Once started, the
+// request is not cancelled by the lane stopping, so that shutting down lets
+// it complete rather than failing it, but only by the drain timing out. No
+// request starts once draining.
+//-----------------------------------------------------------------------------
+
+func (s *scheduler) send(ctx context.Context, service string) {
+
+	// Count the request before waiting for a slot, so that wait covers it
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return
+	}
+	s.inFlight.Add(1)
+	s.mu.Unlock()
+	defer s.inFlight.Done()
+
+	// Acquire a concurrency slot
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	if ctx.Err() != nil {
+		<-s.sem
+		return
+	}
+
+	hctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(s.aborted, cancel)
+	defer stop()
+	s.hop(hctx, service)
+	<-s.sem
+}
+
+//-----------------------------------------------------------------------------
+// wait stops new requests and blocks until the ones in flight have
+// completed. Those still in flight after the timeout are cancelled, so that
+// a peer that never answers cannot hold up the shutdown.
+//-----------------------------------------------------------------------------
+
+func (s *scheduler) wait(timeout time.Duration) {
+
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	// Wait for the requests in flight
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	// Cancel the ones left
+	log.Info("cancelling the requests still in flight", "timeout", timeout)
+	s.abort()
+	<-done
+}
@@ -0,0 +1,201 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	// Community
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// TestNewScheduler
+//-----------------------------------------------------------------------------
+
+func TestNewScheduler(t *testing.T) {
+
+	valid := func() common.FlagPack {
+		return common.FlagPack{
+			WorkerRateMode:            RateModePerDestination,
+			WorkerConcurrency:         1,
+			WorkerRequestInterval:     time.Second,
+			WorkerProfile:             ProfileConstant,
+			WorkerDestinationStrategy: StrategyRoundRobin,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(f *common.FlagPack)
+		interval time.Duration
+		err      bool
+	}{
+		{name: "legacy interval", modify: func(*common.FlagPack) {}, interval: time.Second},
+		{name: "rate", modify: func(f *common.FlagPack) { f.WorkerRate = 4 }, interval: 250 * time.Millisecond},
+		{name: "per-worker", modify: func(f *common.FlagPack) { f.WorkerRateMode = RateModePerWorker }, interval: time.Second},
+		{name: "unknown mode", modify: func(f *common.FlagPack) { f.WorkerRateMode = "bursty" }, err: true},
+		{name: "no concurrency", modify: func(f *common.FlagPack) { f.WorkerConcurrency = 0 }, err: true},
+		{name: "no interval", modify: func(f *common.FlagPack) { f.WorkerRequestInterval = 0 }, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := valid()
+			tt.modify(&flags)
+			s, err := newScheduler(&flags, func(context.Context, string) {})
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if err == nil && s.interval != tt.interval {
+				t.Errorf("got interval %s, want %s", s.interval, tt.interval)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestSchedulerDispatch checks that busy lanes give their turn away and that
+// a tick finding every lane busy is skipped.
+//-----------------------------------------------------------------------------
+
+func TestSchedulerDispatch(t *testing.T) {
+
+	s := &scheduler{strategy: &roundRobinStrategy{}, lanes: map[string]*lane{}}
+	for _, service := range []string{"a:80", "b:80"} {
+		s.lanes[service] = &lane{service: service, inbox: make(chan struct{}, 1)}
+		s.ring = append(s.ring, service)
+	}
+	s.strategy.update(s.ring)
+
+	skipped := testutil.ToFloat64(schedulerSkipped)
+	s.dispatch()
+	s.dispatch()
+	if len(s.lanes["a:80"].inbox) != 1 || len(s.lanes["b:80"].inbox) != 1 {
+		t.Fatalf("got inboxes %d and %d, want one request each", len(s.lanes["a:80"].inbox), len(s.lanes["b:80"].inbox))
+	}
+	if got := testutil.ToFloat64(schedulerSkipped) - skipped; got != 0 {
+		t.Errorf("got %v skipped ticks, want 0", got)
+	}
+
+	// Every lane is busy now
+	s.dispatch()
+	if got := testutil.ToFloat64(schedulerSkipped) - skipped; got != 1 {
+		t.Errorf("got %v skipped ticks, want 1", got)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestSchedulerDrain checks that wait blocks until the requests in flight
+// are done, and that no request starts once draining.
+//-----------------------------------------------------------------------------
+
+func TestSchedulerDrain(t *testing.T) {
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	var hopErr error
+	aborted, abort := context.WithCancel(context.Background())
+	defer abort()
+	s := &scheduler{
+		sem:     make(chan struct{}, 1),
+		aborted: aborted,
+		abort:   abort,
+		hop: func(ctx context.Context, service string) {
+			started <- service
+			<-release
+			hopErr = ctx.Err()
+		},
+	}
+
+	// A request in flight is not cancelled by its lane stopping
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.send(ctx, "a:80")
+	<-started
+	cancel()
+
+	// wait blocks until it completes
+	done := make(chan struct{})
+	go func() {
+		s.wait(time.Minute)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("wait returned with a request in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return once the request completed")
+	}
+	if hopErr != nil {
+		t.Errorf("request in flight got cancelled: %v", hopErr)
+	}
+
+	// No request starts once draining
+	s.send(context.Background(), "b:80")
+	select {
+	case service := <-started:
+		t.Errorf("request to %s started while draining", service)
+	default:
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestSchedulerDrainTimeout checks that wait cancels the requests still in
+// flight once the timeout is over.
+//-----------------------------------------------------------------------------
+
+func TestSchedulerDrainTimeout(t *testing.T) {
+
+	started := make(chan struct{})
+	hopErr := make(chan error, 1)
+	aborted, abort := context.WithCancel(context.Background())
+	defer abort()
+	s := &scheduler{
+		sem:     make(chan struct{}, 1),
+		aborted: aborted,
+		abort:   abort,
+		hop: func(ctx context.Context, _ string) {
+			close(started)
+			<-ctx.Done()
+			hopErr <- ctx.Err()
+		},
+	}
+
+	// A request that never completes
+	go s.send(context.Background(), "a:80")
+	<-started
+
+	// wait gives up on it after the timeout
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		s.wait(50 * time.Millisecond)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return after the timeout")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("wait returned after %s, before the timeout", elapsed)
+	}
+	if err := <-hopErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want the request cancelled", err)
+	}
+}
@@ -0,0 +1,248 @@
+package worker
+
+import (
+
+	// Stdlib
+	"cmp"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	// Community
+	"github.com/gin-gonic/gin"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Destination stats
+//
+// Every hop is also kept in a per-destination ring of the last
+// --worker-stats-samples results. GET /stats summarizes the ones within
+// --worker-stats-window: how many requests were made, which share of them
+// succeeded (no error and a status below 400) and the latency percentiles of
+// the successful ones, along with the last success and the last error seen
+// regardless of the window. Destinations not called within the window are
+// dropped.
+//-----------------------------------------------------------------------------
+
+var stats = &statsStore{dests: map[string]*destStats{}}
+
+//-----------------------------------------------------------------------------
+// statsStore holds the stats of every destination
+//-----------------------------------------------------------------------------
+
+type statsStore struct {
+	mu      sync.Mutex
+	window  time.Duration
+	samples int
+	dests   map[string]*destStats
+}
+
+//-----------------------------------------------------------------------------
+// destStats is the rolling record of one destination
+//-----------------------------------------------------------------------------
+
+type destStats struct {
+	dst         peerInfo
+	ring        []sample
+	next        int
+	lastSuccess time.Time
+	lastError   *lastError
+}
+
+type sample struct {
+	at       time.Time
+	ok       bool
+	duration time.Duration
+}
+
+type lastError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+//-----------------------------------------------------------------------------
+// setupStats sizes the store from the flags
+//-----------------------------------------------------------------------------
+
+func setupStats(flags *common.FlagPack) error {
+
+	if flags.WorkerStatsWindow <= 0 || flags.WorkerStatsSamples < 1 {
+		return fmt.Errorf("stats window must be positive and samples at least 1, got %s and %d", flags.WorkerStatsWindow, flags.WorkerStatsSamples)
+	}
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.window = flags.WorkerStatsWindow
+	stats.samples = flags.WorkerStatsSamples
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// record adds the outcome of a hop to its destination's ring
+//-----------------------------------------------------------------------------
+
+func (s *statsStore) record(service string, res hopResult) {
+
+	now := time.Now()
+	ok := res.err == nil && res.status < 400
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Find or create the destination
+	d, found := s.dests[service]
+	if !found {
+		d = &destStats{ring: make([]sample, 0, s.samples)}
+		s.dests[service] = d
+	}
+
+	// Remember the last outcomes
+	if res.dst.Pod != "" || res.dst.Cluster != "" {
+		d.dst = res.dst
+	}
+	if ok {
+		d.lastSuccess = now
+	} else {
+		msg := fmt.Sprint(res.err)
+		if res.err == nil {
+			msg = fmt.Sprintf("status %d", res.status)
+		}
+		d.lastError = &lastError{Time: now, Error: msg}
+	}
+
+	// Append to the ring, overwriting the oldest sample once full
+	smp := sample{at: now, ok: ok, duration: res.duration}
+	if len(d.ring) < cap(d.ring) {
+		d.ring = append(d.ring, smp)
+		return
+	}
+	d.ring[d.next] = smp
+	d.next = (d.next + 1) % len(d.ring)
+}
+
+//-----------------------------------------------------------------------------
+// reachable returns how many of the services succeeded at least once within
+// the window.
+//-----------------------------------------------------------------------------
+
+func (s *statsStore) reachable(services []string) int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := time.Now().Add(-s.window)
+	n := 0
+	for _, service := range services {
+		if d, ok := s.dests[service]; ok && d.lastSuccess.After(since) {
+			n++
+		}
+	}
+	return n
+}
+
+//-----------------------------------------------------------------------------
+// destSummary is the /stats view of one destination
+//-----------------------------------------------------------------------------
+
+type destSummary struct {
+	Service      string      `json:"service"`
+	Dst          *peerInfo   `json:"dst,omitempty"`
+	Requests     int         `json:"requests"`
+	Successes    int         `json:"successes"`
+	SuccessRatio float64     `json:"success_ratio"`
+	LastSuccess  *time.Time  `json:"last_success,omitempty"`
+	LastError    *lastError  `json:"last_error,omitempty"`
+	LatencyMs    *latencySum `json:"latency_ms,omitempty"`
+}
+
+type latencySum struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+//-----------------------------------------------------------------------------
+// summary returns the window and the stats of every destination called
+// within it, sorted by service, and drops the others.
+//-----------------------------------------------------------------------------
+
+func (s *statsStore) summary() (time.Duration, []destSummary) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := time.Now().Add(-s.window)
+	out := []destSummary{}
+	for service, d := range s.dests {
+
+		// Collect the samples within the window
+		sum := destSummary{Service: service, LastError: d.lastError}
+		var latencies []time.Duration
+		for _, smp := range d.ring {
+			if smp.at.Before(since) {
+				continue
+			}
+			sum.Requests++
+			if smp.ok {
+				sum.Successes++
+				latencies = append(latencies, smp.duration)
+			}
+		}
+		if sum.Requests == 0 {
+			delete(s.dests, service)
+			continue
+		}
+
+		// Summarize them
+		sum.SuccessRatio = float64(sum.Successes) / float64(sum.Requests)
+		if !d.lastSuccess.IsZero() {
+			t := d.lastSuccess
+			sum.LastSuccess = &t
+		}
+		if d.dst != (peerInfo{}) {
+			dst := d.dst
+			sum.Dst = &dst
+		}
+		if len(latencies) > 0 {
+			slices.Sort(latencies)
+			sum.LatencyMs = &latencySum{
+				P50: percentileMs(latencies, 0.50),
+				P90: percentileMs(latencies, 0.90),
+				P99: percentileMs(latencies, 0.99),
+			}
+		}
+		out = append(out, sum)
+	}
+
+	slices.SortFunc(out, func(a, b destSummary) int { return cmp.Compare(a.Service, b.Service) })
+	return s.window, out
+}
+
+//-----------------------------------------------------------------------------
+// percentileMs returns the nearest-rank percentile of sorted durations, in
+// milliseconds.
+//-----------------------------------------------------------------------------
+
+func percentileMs(sorted []time.Duration, p float64) float64 {
+	i := max(int(math.Ceil(p*float64(len(sorted))))-1, 0)
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
+
+//-----------------------------------------------------------------------------
+// getStats answers /stats
+//-----------------------------------------------------------------------------
+
+func getStats(c *gin.Context) {
+	window, dests := stats.summary()
+	c.JSON(http.StatusOK, gin.H{
+		"src":          localPeer(),
+		"window":       window.String(),
+		"destinations": dests,
+	})
+}
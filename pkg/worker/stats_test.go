@@ -0,0 +1,197 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+//-----------------------------------------------------------------------------
+// TestStatsSummary records hops into a fresh store and checks the summary
+//-----------------------------------------------------------------------------
+
+func TestStatsSummary(t *testing.T) {
+
+	ok := func(ms int) hopResult {
+		return hopResult{status: http.StatusOK, duration: time.Duration(ms) * time.Millisecond}
+	}
+
+	tests := []struct {
+		name      string
+		samples   int
+		hops      []hopResult
+		age       time.Duration
+		requests  int
+		successes int
+		latency   *latencySum
+		lastError string
+	}{
+		{
+			name:      "all successful",
+			samples:   10,
+			hops:      []hopResult{ok(10), ok(20), ok(30), ok(40)},
+			requests:  4,
+			successes: 4,
+			latency:   &latencySum{P50: 20, P90: 40, P99: 40},
+		},
+		{
+			name:      "failures left out of the latency",
+			samples:   10,
+			hops:      []hopResult{ok(10), {status: http.StatusServiceUnavailable, duration: time.Second}, {err: errors.New("refused")}},
+			requests:  3,
+			successes: 1,
+			latency:   &latencySum{P50: 10, P90: 10, P99: 10},
+			lastError: "refused",
+		},
+		{
+			name:      "error status",
+			samples:   10,
+			hops:      []hopResult{{status: http.StatusNotFound}},
+			requests:  1,
+			lastError: "status 404",
+		},
+		{
+			name:      "ring keeps the last samples",
+			samples:   2,
+			hops:      []hopResult{{err: errors.New("refused")}, ok(10), ok(30)},
+			requests:  2,
+			successes: 2,
+			latency:   &latencySum{P50: 10, P90: 30, P99: 30},
+			lastError: "refused",
+		},
+		{
+			name:    "outside the window",
+			samples: 10,
+			hops:    []hopResult{ok(10)},
+			age:     2 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Record the hops, aged if asked to
+			s := &statsStore{window: time.Minute, samples: tt.samples, dests: map[string]*destStats{}}
+			for _, res := range tt.hops {
+				s.record("a.ns:80", res)
+			}
+			for i := range s.dests["a.ns:80"].ring {
+				s.dests["a.ns:80"].ring[i].at = s.dests["a.ns:80"].ring[i].at.Add(-tt.age)
+			}
+
+			// Destinations without requests in the window are dropped
+			window, dests := s.summary()
+			if window != time.Minute {
+				t.Errorf("got window %s, want 1m", window)
+			}
+			if tt.requests == 0 {
+				if len(dests) != 0 || len(s.dests) != 0 {
+					t.Errorf("got %d destinations, want them dropped", len(dests))
+				}
+				return
+			}
+			if len(dests) != 1 {
+				t.Fatalf("got %d destinations, want 1", len(dests))
+			}
+
+			// Check the summary
+			d := dests[0]
+			if d.Requests != tt.requests || d.Successes != tt.successes {
+				t.Errorf("got %d/%d successes, want %d/%d", d.Successes, d.Requests, tt.successes, tt.requests)
+			}
+			if want := float64(tt.successes) / float64(tt.requests); d.SuccessRatio != want {
+				t.Errorf("got success ratio %v, want %v", d.SuccessRatio, want)
+			}
+			if (d.LatencyMs == nil) != (tt.latency == nil) || (d.LatencyMs != nil && *d.LatencyMs != *tt.latency) {
+				t.Errorf("got latency %+v, want %+v", d.LatencyMs, tt.latency)
+			}
+			if (d.LastSuccess != nil) != (tt.successes > 0) {
+				t.Errorf("got last success %v, want one: %v", d.LastSuccess, tt.successes > 0)
+			}
+			got := ""
+			if d.LastError != nil {
+				got = d.LastError.Error
+			}
+			if got != tt.lastError {
+				t.Errorf("got last error %q, want %q", got, tt.lastError)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestPercentileMs
+//-----------------------------------------------------------------------------
+
+func TestPercentileMs(t *testing.T) {
+
+	ms := func(v ...int) []time.Duration {
+		var out []time.Duration
+		for _, n := range v {
+			out = append(out, time.Duration(n)*time.Millisecond)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      float64
+		want   float64
+	}{
+		{name: "single", sorted: ms(7), p: 0.99, want: 7},
+		{name: "median of even", sorted: ms(1, 2, 3, 4), p: 0.5, want: 2},
+		{name: "median of odd", sorted: ms(1, 2, 3), p: 0.5, want: 2},
+		{name: "p90 of ten", sorted: ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), p: 0.9, want: 9},
+		{name: "zero", sorted: ms(1, 2), p: 0, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentileMs(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestStatsReachable
+//-----------------------------------------------------------------------------
+
+func TestStatsReachable(t *testing.T) {
+
+	s := &statsStore{window: time.Minute, samples: 10, dests: map[string]*destStats{}}
+	s.record("up.ns:80", hopResult{status: http.StatusOK})
+	s.record("down.ns:80", hopResult{status: http.StatusServiceUnavailable})
+	s.record("stale.ns:80", hopResult{status: http.StatusOK})
+	s.dests["stale.ns:80"].lastSuccess = time.Now().Add(-2 * time.Minute)
+
+	tests := []struct {
+		name     string
+		services []string
+		want     int
+	}{
+		{name: "none", services: nil, want: 0},
+		{name: "succeeded", services: []string{"up.ns:80"}, want: 1},
+		{name: "failed", services: []string{"down.ns:80"}, want: 0},
+		{name: "outside the window", services: []string{"stale.ns:80"}, want: 0},
+		{name: "never called", services: []string{"new.ns:80"}, want: 0},
+		{name: "mixed", services: []string{"up.ns:80", "down.ns:80", "stale.ns:80", "new.ns:80"}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.reachable(tt.services); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package worker
+
+import (
+
+	// Stdlib
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Destination strategies
+//
+// In per-worker rate mode the dispatcher decides which destination every
+// request goes to. The strategy makes that decision: cycle through the
+// informer's list, draw uniformly, draw by configured weights, draw from a
+// Zipf distribution over the list so that the first few services are hot
+// spots with a long tail behind them, or prefer destinations in the worker's
+// own cluster. In per-destination mode every destination paces itself and
+// no choice is made.
+//-----------------------------------------------------------------------------
+
+const (
+	StrategyRoundRobin = "round-robin"
+	StrategyRandom     = "random"
+	StrategyWeighted   = "weighted"
+	StrategyZipf       = "zipf"
+	StrategyLocality   = "locality"
+)
+
+//-----------------------------------------------------------------------------
+// strategy picks the destinations of the dispatcher. update is called with
+// the dispatch ring, in informer order, whenever it changes, and pick
+// returns the next destination to try, or "" if none may be picked. Both
+// are called with the scheduler lock held.
+//-----------------------------------------------------------------------------
+
+type strategy interface {
+	update(ring []string)
+	pick() string
+}
+
+//-----------------------------------------------------------------------------
+// newStrategy returns the strategy selected by the worker flags
+//-----------------------------------------------------------------------------
+
+func newStrategy(flags *common.FlagPack) (strategy, error) {
+
+	// Only the dispatcher makes choices
+	if flags.WorkerDestinationStrategy != StrategyRoundRobin && flags.WorkerRateMode != RateModePerWorker {
+		return nil, fmt.Errorf("the %s destination strategy requires the %s rate mode", flags.WorkerDestinationStrategy, RateModePerWorker)
+	}
+
+	// Select the strategy
+	switch flags.WorkerDestinationStrategy {
+	case StrategyRoundRobin:
+		return &roundRobinStrategy{}, nil
+	case StrategyRandom:
+		return &weightedStrategy{weight: func(int, string) float64 { return 1 }}, nil
+	case StrategyWeighted:
+		for key, w := range flags.WorkerDestinationWeights {
+			if w < 0 {
+				return nil, fmt.Errorf("destination weight of %q must not be negative, got %d", key, w)
+			}
+		}
+		weights := flags.WorkerDestinationWeights
+		return &weightedStrategy{weight: func(_ int, service string) float64 {
+			return float64(destinationWeight(weights, service))
+		}}, nil
+	case StrategyZipf:
+		s := flags.WorkerDestinationZipfExponent
+		if s <= 0 {
+			return nil, fmt.Errorf("zipf exponent must be positive, got %v", s)
+		}
+		return &weightedStrategy{weight: func(rank int, _ string) float64 {
+			return 1 / math.Pow(float64(rank+1), s)
+		}}, nil
+	case StrategyLocality:
+		bias := flags.WorkerDestinationLocalityBias
+		if bias < 0 || bias > 1 {
+			return nil, fmt.Errorf("locality bias must be in [0, 1], got %v", bias)
+		}
+		return &localityStrategy{cluster: localPeer().Cluster, bias: bias}, nil
+	default:
+		return nil, fmt.Errorf("unknown destination strategy %q", flags.WorkerDestinationStrategy)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// roundRobinStrategy cycles through the ring in informer order
+//-----------------------------------------------------------------------------
+
+type roundRobinStrategy struct {
+	ring []string
+	next int
+}
+
+func (s *roundRobinStrategy) update(ring []string) {
+	s.ring = ring
+}
+
+func (s *roundRobinStrategy) pick() string {
+	if len(s.ring) == 0 {
+		return ""
+	}
+	service := s.ring[s.next%len(s.ring)]
+	s.next = (s.next + 1) % len(s.ring)
+	return service
+}
+
+//-----------------------------------------------------------------------------
+// weightedStrategy draws destinations with probability proportional to
+// their weight, given their rank in the ring and their address. Uniform and
+// Zipf draws are weightings too.
+//-----------------------------------------------------------------------------
+
+type weightedStrategy struct {
+	weight func(rank int, service string) float64
+	ring   []string
+	cum    []float64
+}
+
+func (s *weightedStrategy) update(ring []string) {
+	s.ring = ring
+	s.cum = s.cum[:0]
+	total := 0.0
+	for rank, service := range ring {
+		total += s.weight(rank, service)
+		s.cum = append(s.cum, total)
+	}
+}
+
+func (s *weightedStrategy) pick() string {
+	if len(s.cum) == 0 || s.cum[len(s.cum)-1] <= 0 {
+		return ""
+	}
+	x := rand.Float64() * s.cum[len(s.cum)-1]
+	return s.ring[sort.SearchFloat64s(s.cum, math.Nextafter(x, math.Inf(1)))]
+}
+
+//-----------------------------------------------------------------------------
+// destinationWeight returns the weight configured for a service, looked up
+// by its destination, then by its address, then by its host, then by its
+// namespace. Services without a weight get 1.
+//-----------------------------------------------------------------------------
+
+func destinationWeight(weights map[string]int, service string) int {
+	addr, _ := splitDestination(service)
+	host, _, _ := strings.Cut(addr, ":")
+	for _, key := range []string{service, addr, host, serviceNamespace(service)} {
+		if w, ok := weights[key]; ok {
+			return w
+		}
+	}
+	return 1
+}
+
+//-----------------------------------------------------------------------------
+// localityStrategy sends a bias fraction of the requests to destinations in
+// the worker's own cluster and the rest elsewhere, uniformly within each
+// group. Only cluster-qualified destinations say where their peers run, so
+// the cluster of the others is learned from their answers; destinations not
+// heard from yet count as local so that they are probed early. When one group
+// is empty the other gets all the requests. The groups are split on update,
+// and again once the cluster of a destination is learned.
+//-----------------------------------------------------------------------------
+
+type localityStrategy struct {
+	cluster string
+	bias    float64
+	ring    []string
+	local   []string
+	remote  []string
+	version uint64
+}
+
+func (s *localityStrategy) update(ring []string) {
+	s.ring = ring
+	s.split()
+}
+
+func (s *localityStrategy) split() {
+	s.version = destinationClustersVersion.Load()
+	s.local, s.remote = s.local[:0], s.remote[:0]
+	for _, service := range s.ring {
+		if c, ok := destinationCluster(service); ok && c != s.cluster {
+			s.remote = append(s.remote, service)
+		} else {
+			s.local = append(s.local, service)
+		}
+	}
+}
+
+func (s *localityStrategy) pick() string {
+
+	// Split the ring again if a cluster was learned since
+	if s.version != destinationClustersVersion.Load() {
+		s.split()
+	}
+
+	// Pick a group, then a destination in it
+	group := s.local
+	if len(s.local) == 0 || (len(s.remote) > 0 && rand.Float64() >= s.bias) {
+		group = s.remote
+	}
+	if len(group) == 0 {
+		return ""
+	}
+	return group[rand.N(len(group))]
+}
+
+//-----------------------------------------------------------------------------
+// destinationClusters maps every destination to the cluster of the peer that
+// last answered it, and destinationClustersVersion counts its changes.
+//-----------------------------------------------------------------------------
+
+var (
+	destinationClusters        sync.Map
+	destinationClustersVersion atomic.Uint64
+)
+
+func destinationCluster(service string) (string, bool) {
+	if _, cluster := splitDestination(service); cluster != "" {
+		return cluster, true
+	}
+	c, ok := destinationClusters.Load(service)
+	if !ok {
+		return "", false
+	}
+	return c.(string), true
+}
+
+func observeDestination(service string, dst peerInfo) {
+	if dst.Cluster == "" {
+		return
+	}
+	if prev, loaded := destinationClusters.Swap(service, dst.Cluster); !loaded || prev.(string) != dst.Cluster {
+		destinationClustersVersion.Add(1)
+	}
+}
@@ -0,0 +1,214 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"slices"
+	"testing"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// TestNewStrategy
+//-----------------------------------------------------------------------------
+
+func TestNewStrategy(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		flags common.FlagPack
+		ok    bool
+	}{
+		{name: "round-robin per-destination", flags: common.FlagPack{WorkerDestinationStrategy: StrategyRoundRobin, WorkerRateMode: RateModePerDestination}, ok: true},
+		{name: "random per-destination", flags: common.FlagPack{WorkerDestinationStrategy: StrategyRandom, WorkerRateMode: RateModePerDestination}},
+		{name: "random", flags: common.FlagPack{WorkerDestinationStrategy: StrategyRandom, WorkerRateMode: RateModePerWorker}, ok: true},
+		{name: "weighted", flags: common.FlagPack{WorkerDestinationStrategy: StrategyWeighted, WorkerRateMode: RateModePerWorker, WorkerDestinationWeights: map[string]int{"n1": 3}}, ok: true},
+		{name: "negative weight", flags: common.FlagPack{WorkerDestinationStrategy: StrategyWeighted, WorkerRateMode: RateModePerWorker, WorkerDestinationWeights: map[string]int{"n1": -1}}},
+		{name: "zipf", flags: common.FlagPack{WorkerDestinationStrategy: StrategyZipf, WorkerRateMode: RateModePerWorker, WorkerDestinationZipfExponent: 1.1}, ok: true},
+		{name: "zipf zero exponent", flags: common.FlagPack{WorkerDestinationStrategy: StrategyZipf, WorkerRateMode: RateModePerWorker}},
+		{name: "locality", flags: common.FlagPack{WorkerDestinationStrategy: StrategyLocality, WorkerRateMode: RateModePerWorker, WorkerDestinationLocalityBias: 0.8}, ok: true},
+		{name: "locality bias above 1", flags: common.FlagPack{WorkerDestinationStrategy: StrategyLocality, WorkerRateMode: RateModePerWorker, WorkerDestinationLocalityBias: 1.5}},
+		{name: "unknown", flags: common.FlagPack{WorkerDestinationStrategy: "nearest", WorkerRateMode: RateModePerWorker}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newStrategy(&tt.flags); (err == nil) != tt.ok {
+				t.Errorf("got error %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestRoundRobinStrategy
+//-----------------------------------------------------------------------------
+
+func TestRoundRobinStrategy(t *testing.T) {
+
+	// The strategy is shared, so that every ring picks up where the last left
+	s := &roundRobinStrategy{}
+
+	tests := []struct {
+		name string
+		ring []string
+		want []string
+	}{
+		{name: "empty", ring: nil, want: []string{""}},
+		{name: "cycles", ring: []string{"a:80", "b:80", "c:80"}, want: []string{"a:80", "b:80", "c:80", "a:80"}},
+		{name: "shorter ring", ring: []string{"a:80"}, want: []string{"a:80", "a:80"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.update(tt.ring)
+			var got []string
+			for range tt.want {
+				got = append(got, s.pick())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestDestinationWeight
+//-----------------------------------------------------------------------------
+
+func TestDestinationWeight(t *testing.T) {
+
+	weights := map[string]int{
+		"peer.n1:80@east": 7,
+		"peer.n1:80":      5,
+		"peer.n2":         3,
+		"n3":              0,
+	}
+
+	tests := []struct {
+		service string
+		want    int
+	}{
+		{service: "peer.n1:80@east", want: 7},
+		{service: "peer.n1:80@west", want: 5},
+		{service: "peer.n1:80", want: 5},
+		{service: "peer.n1:81", want: 1},
+		{service: "peer.n2:80", want: 3},
+		{service: "peer.n3:80", want: 0},
+		{service: "peer.n4:80", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			if got := destinationWeight(weights, tt.service); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestWeightedStrategy
+//-----------------------------------------------------------------------------
+
+func TestWeightedStrategy(t *testing.T) {
+
+	weights := map[string]int{"a:80": 0, "b:80": 2, "c:80": 0}
+	s := &weightedStrategy{weight: func(_ int, service string) float64 {
+		return float64(destinationWeight(weights, service))
+	}}
+
+	tests := []struct {
+		name string
+		ring []string
+		want []string
+	}{
+		{name: "empty", ring: nil, want: []string{""}},
+		{name: "all zero", ring: []string{"a:80", "c:80"}, want: []string{""}},
+		{name: "zero weights skipped", ring: []string{"a:80", "b:80", "c:80"}, want: []string{"b:80"}},
+		{name: "default weight", ring: []string{"a:80", "d:80", "e:80"}, want: []string{"d:80", "e:80"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.update(tt.ring)
+			for range 100 {
+				if got := s.pick(); !slices.Contains(tt.want, got) {
+					t.Fatalf("picked %q, want one of %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// A cluster learned after the update moves the destination
+	t.Run("cluster learned", func(t *testing.T) {
+		s := &localityStrategy{cluster: "east", bias: 1}
+		s.update([]string{"peer.n5:80", "peer.n1:80"})
+		observeDestination("peer.n5:80", peerInfo{Cluster: "west"})
+		for range 100 {
+			if got := s.pick(); got != "peer.n1:80" {
+				t.Fatalf("picked %q, want peer.n1:80", got)
+			}
+		}
+	})
+}
+
+//-----------------------------------------------------------------------------
+// TestLocalityStrategy
+//-----------------------------------------------------------------------------
+
+func TestLocalityStrategy(t *testing.T) {
+
+	// The cluster of an unqualified destination is learned from its answers
+	observeDestination("peer.n1:80", peerInfo{Cluster: "east"})
+	observeDestination("peer.n2:80", peerInfo{Cluster: "west"})
+	observeDestination("peer.n3:80", peerInfo{})
+
+	tests := []struct {
+		name string
+		bias float64
+		ring []string
+		want []string
+	}{
+		{name: "empty", bias: 1, ring: nil, want: []string{""}},
+		{name: "all local", bias: 1, ring: []string{"peer.n1:80", "peer.n2:80"}, want: []string{"peer.n1:80"}},
+		{name: "all remote", bias: 0, ring: []string{"peer.n1:80", "peer.n2:80"}, want: []string{"peer.n2:80"}},
+		{name: "no local", bias: 1, ring: []string{"peer.n2:80"}, want: []string{"peer.n2:80"}},
+		{name: "no remote", bias: 0, ring: []string{"peer.n1:80"}, want: []string{"peer.n1:80"}},
+		{name: "unknown counts as local", bias: 1, ring: []string{"peer.n3:80", "peer.n2:80"}, want: []string{"peer.n3:80"}},
+		{name: "qualified local", bias: 1, ring: []string{"peer.n4:80@east", "peer.n4:80@west"}, want: []string{"peer.n4:80@east"}},
+		{name: "qualified remote", bias: 0, ring: []string{"peer.n4:80@east", "peer.n4:80@west"}, want: []string{"peer.n4:80@west"}},
+		{name: "qualifier over answers", bias: 1, ring: []string{"peer.n2:80@east", "peer.n2:80"}, want: []string{"peer.n2:80@east"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &localityStrategy{cluster: "east", bias: tt.bias}
+			s.update(tt.ring)
+			for range 100 {
+				if got := s.pick(); !slices.Contains(tt.want, got) {
+					t.Fatalf("picked %q, want one of %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// A cluster learned after the update moves the destination
+	t.Run("cluster learned", func(t *testing.T) {
+		s := &localityStrategy{cluster: "east", bias: 1}
+		s.update([]string{"peer.n5:80", "peer.n1:80"})
+		observeDestination("peer.n5:80", peerInfo{Cluster: "west"})
+		for range 100 {
+			if got := s.pick(); got != "peer.n1:80" {
+				t.Fatalf("picked %q, want peer.n1:80", got)
+			}
+		}
+	})
+}
@@ -0,0 +1,275 @@
+package worker
+
+import (
+
+	// Stdlib
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	// Community
+	"github.com/prometheus/client_golang/prometheus"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Framing
+//
+// Every message on the TCP port is a frame: a 4-byte big-endian length
+// followed by that many bytes of payload. On accept the server sends one
+// hello frame holding its peerInfo as JSON, then echoes back every frame it
+// receives until the client closes the connection.
+//-----------------------------------------------------------------------------
+
+const maxFrameSize = 1 << 20
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+var (
+	tcpConnectDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "tcp_connect_duration_seconds",
+		Help:      "Time taken by the worker to open a TCP connection to a peer.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"src_cluster", "src_namespace", "dst_cluster", "dst_namespace"})
+
+	tcpBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "tcp_bytes_total",
+		Help:      "Bytes exchanged by the worker with its peers over raw TCP, including framing.",
+	}, []string{"src_cluster", "src_namespace", "dst_cluster", "dst_namespace", "direction"})
+)
+
+func init() {
+	registry.MustRegister(tcpConnectDuration, tcpBytes)
+}
+
+//-----------------------------------------------------------------------------
+// tcpInfo groups TCP-level fields under a single nested object in the log
+// line, mirroring httpInfo.
+//-----------------------------------------------------------------------------
+
+type tcpInfo struct {
+	ConnectMs     int64 `json:"connect_ms"`
+	Frames        int   `json:"frames"`
+	BytesSent     int64 `json:"bytes_sent"`
+	BytesReceived int64 `json:"bytes_received"`
+}
+
+//-----------------------------------------------------------------------------
+// validateTCP checks that the frames the client sends fit the protocol
+//-----------------------------------------------------------------------------
+
+func validateTCP(flags *common.FlagPack) error {
+	if size := flags.WorkerTCPPayloadSize; size < 0 || size > maxFrameSize {
+		return fmt.Errorf("tcp payload size must be in [0, %d], got %d", maxFrameSize, size)
+	}
+	if flags.WorkerTCPFrames < 1 {
+		return fmt.Errorf("tcp frames must be at least 1, got %d", flags.WorkerTCPFrames)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// tcpServer starts the worker TCP echo server
+//-----------------------------------------------------------------------------
+
+func tcpServer(ctx context.Context, flags *common.FlagPack) error {
+
+	// "0" disables the server
+	if flags.WorkerTCPBindAddr == "0" {
+		log.Info("worker tcp server disabled")
+		return nil
+	}
+
+	// Listen
+	lis, err := net.Listen("tcp", flags.WorkerTCPBindAddr)
+	if err != nil {
+		return err
+	}
+
+	// Stop accepting once drained. Open connections are echoed until their
+	// client hangs up or the process exits.
+	var stopped atomic.Bool
+	stop := context.AfterFunc(ctx, func() {
+		time.Sleep(flags.ShutdownDrainPeriod)
+		stopped.Store(true)
+		_ = lis.Close()
+	})
+	defer stop()
+
+	// Accept
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if stopped.Load() {
+				return nil
+			}
+			return fmt.Errorf("worker tcp server stopped accepting connections: %w", err)
+		}
+		go echo(conn)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// echo sends the hello frame and echoes frames back until EOF
+//-----------------------------------------------------------------------------
+
+func echo(conn net.Conn) {
+
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.V(1).Info("failed to close tcp connection", "error", err.Error())
+		}
+	}()
+
+	// Say hello
+	hello, err := json.Marshal(localPeer())
+	if err != nil {
+		log.Error(err, "unable to marshal hello frame")
+		return
+	}
+	if _, err := writeFrame(conn, hello); err != nil {
+		return
+	}
+
+	// Echo
+	for {
+		payload, _, err := readFrame(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.V(1).Info("tcp echo failed", "remote", conn.RemoteAddr().String(), "error", err.Error())
+			}
+			return
+		}
+		if _, err := writeFrame(conn, payload); err != nil {
+			return
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// tcpCall opens a connection to a peer, exchanges the configured number of
+// frames and closes it.
+//-----------------------------------------------------------------------------
+
+func tcpCall(ctx context.Context, flags *common.FlagPack, service string) hopResult {
+
+	// Connect
+	start := time.Now()
+	var dialer net.Dialer
+	addr, _ := splitDestination(service)
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return hopResult{err: err, duration: time.Since(start)}
+	}
+	connect := time.Since(start)
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.V(1).Info("failed to close tcp connection", "service", service, "error", err.Error())
+		}
+	}()
+
+	// Abort the exchange if the context is cancelled
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// Read the hello frame
+	info := tcpInfo{ConnectMs: connect.Milliseconds()}
+	hello, n, err := readFrame(conn)
+	info.BytesReceived += n
+	if err != nil {
+		return hopResult{err: fmt.Errorf("failed to read hello frame: %w", err), duration: time.Since(start), info: info}
+	}
+	res := hopResult{info: info}
+	if err := json.Unmarshal(hello, &res.dst); err != nil {
+		res.body = hello
+	}
+
+	// Exchange frames
+	payload := make([]byte, flags.WorkerTCPPayloadSize)
+	for range flags.WorkerTCPFrames {
+		if _, err := rand.Read(payload); err != nil {
+			return hopResult{err: err, duration: time.Since(start), info: info}
+		}
+		n, err := writeFrame(conn, payload)
+		info.BytesSent += n
+		if err != nil {
+			return hopResult{err: fmt.Errorf("failed to write frame: %w", err), duration: time.Since(start), info: info}
+		}
+		got, n, err := readFrame(conn)
+		info.BytesReceived += n
+		if err != nil {
+			return hopResult{err: fmt.Errorf("failed to read echo: %w", err), duration: time.Since(start), info: info}
+		}
+		if !bytes.Equal(got, payload) {
+			return hopResult{err: errors.New("echoed frame does not match"), duration: time.Since(start), info: info}
+		}
+		info.Frames++
+	}
+
+	// Record the connection-level metrics
+	res.duration = time.Since(start)
+	res.info = info
+	observeTCP(res.dst, service, connect, info)
+	return res
+}
+
+//-----------------------------------------------------------------------------
+// observeTCP records connect time and byte counts for a completed exchange
+//-----------------------------------------------------------------------------
+
+func observeTCP(dst peerInfo, service string, connect time.Duration, info tcpInfo) {
+
+	labels := peerLabels(localPeer(), dst, service)
+	tcpConnectDuration.With(labels).Observe(connect.Seconds())
+	labels["direction"] = "sent"
+	tcpBytes.With(labels).Add(float64(info.BytesSent))
+	labels["direction"] = "received"
+	tcpBytes.With(labels).Add(float64(info.BytesReceived))
+}
+
+//-----------------------------------------------------------------------------
+// writeFrame writes a length-prefixed frame and returns the bytes written
+//-----------------------------------------------------------------------------
+
+func writeFrame(w io.Writer, payload []byte) (int64, error) {
+	buf := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[4:], payload)
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+//-----------------------------------------------------------------------------
+// readFrame reads a length-prefixed frame and returns its payload and the
+// bytes read.
+//-----------------------------------------------------------------------------
+
+func readFrame(r io.Reader) ([]byte, int64, error) {
+	var size [4]byte
+	if n, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, int64(n), err
+	}
+	length := binary.BigEndian.Uint32(size[:])
+	if length > maxFrameSize {
+		return nil, 4, fmt.Errorf("frame of %d bytes exceeds the %d bytes limit", length, maxFrameSize)
+	}
+	payload := make([]byte, length)
+	n, err := io.ReadFull(r, payload)
+	return payload, int64(4 + n), err
+}
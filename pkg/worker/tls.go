@@ -0,0 +1,204 @@
+package worker
+
+import (
+
+	// Stdlib
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	// Community
+	"github.com/prometheus/client_golang/prometheus"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// TLS
+//
+// With --worker-tls-cert-file and --worker-tls-key-file set, the worker
+// serves its HTTP port (/data and /ws) over TLS and calls its peers over
+// https and wss, verifying their certificates against --worker-tls-ca-file
+// (the system roots if unset) and presenting its own. With
+// --worker-tls-client-auth the server also requires and verifies client
+// certificates, making it mTLS. The key pair is reloaded whenever its files
+// change so that certificates rotated by cert-manager are picked up; the CA
+// bundle is read once at start. gRPC and TCP traffic stays plaintext.
+//-----------------------------------------------------------------------------
+
+// clientTLS is the config peer calls are made with, nil when TLS is off
+var clientTLS *tls.Config
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+var tlsHandshakeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "kswarm",
+	Subsystem: "worker",
+	Name:      "http_tls_handshake_duration_seconds",
+	Help:      "Time taken by the worker to complete TLS handshakes with its peers, by result.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+}, []string{"result"})
+
+func init() {
+	registry.MustRegister(tlsHandshakeDuration)
+}
+
+//-----------------------------------------------------------------------------
+// setupTLS validates the TLS flags and builds the server and client configs.
+// The server config is nil when TLS is off.
+//-----------------------------------------------------------------------------
+
+func setupTLS(flags *common.FlagPack) (*tls.Config, error) {
+
+	// TLS is optional
+	if flags.WorkerTLSCertFile == "" && flags.WorkerTLSKeyFile == "" {
+		if flags.WorkerTLSCAFile != "" || flags.WorkerTLSClientAuth {
+			return nil, fmt.Errorf("the TLS CA file and client auth require a certificate and key")
+		}
+		return nil, nil
+	}
+	if flags.WorkerTLSCertFile == "" || flags.WorkerTLSKeyFile == "" {
+		return nil, fmt.Errorf("the TLS certificate and key files must be set together")
+	}
+	if flags.WorkerTLSClientAuth && flags.WorkerTLSCAFile == "" {
+		return nil, fmt.Errorf("TLS client auth requires a CA file to verify clients against")
+	}
+
+	// Load the key pair
+	pair := &keyPair{certFile: flags.WorkerTLSCertFile, keyFile: flags.WorkerTLSKeyFile}
+	if _, err := pair.load(); err != nil {
+		return nil, err
+	}
+
+	// Load the CA bundle
+	var pool *x509.CertPool
+	if flags.WorkerTLSCAFile != "" {
+		pem, err := os.ReadFile(flags.WorkerTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the TLS CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the TLS CA file %s", flags.WorkerTLSCAFile)
+		}
+	}
+
+	// Client side: verify peers and present our certificate when asked
+	clientTLS = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return pair.load()
+		},
+	}
+
+	// Server side: serve the current certificate, requiring one from
+	// clients in mTLS mode
+	server := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, err := pair.load()
+			if err != nil {
+				return nil, err
+			}
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   []string{"http/1.1"},
+				Certificates: []tls.Certificate{*cert},
+			}
+			if flags.WorkerTLSClientAuth {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = pool
+			}
+			return cfg, nil
+		},
+	}
+
+	log.Info("tls enabled", "client_auth", flags.WorkerTLSClientAuth)
+	return server, nil
+}
+
+//-----------------------------------------------------------------------------
+// scheme returns the TLS variant of a URL scheme when TLS is on
+//-----------------------------------------------------------------------------
+
+func scheme(plain string) string {
+	if clientTLS == nil {
+		return plain
+	}
+	return plain + "s"
+}
+
+//-----------------------------------------------------------------------------
+// keyPair is a certificate and key on disk, reloaded when either file's
+// modification time changes.
+//-----------------------------------------------------------------------------
+
+type keyPair struct {
+	certFile, keyFile string
+
+	mu    sync.Mutex
+	mtime time.Time
+	cert  *tls.Certificate
+}
+
+func (p *keyPair) load() (*tls.Certificate, error) {
+
+	// Stat both files
+	var mtime time.Time
+	for _, name := range []string{p.certFile, p.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat the TLS key pair: %w", err)
+		}
+		if info.ModTime().After(mtime) {
+			mtime = info.ModTime()
+		}
+	}
+
+	// Reload if they changed
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cert != nil && mtime.Equal(p.mtime) {
+		return p.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the TLS key pair: %w", err)
+	}
+	if p.cert != nil {
+		log.Info("tls key pair reloaded", "cert_file", p.certFile)
+	}
+	p.cert, p.mtime = &cert, mtime
+	return p.cert, nil
+}
+
+//-----------------------------------------------------------------------------
+// peerIdentity returns the identity a verified peer certificate asserts: its
+// SPIFFE ID if it has one, else its first DNS SAN, else its common name.
+//-----------------------------------------------------------------------------
+
+func peerIdentity(state *tls.ConnectionState) string {
+
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	cert := state.PeerCertificates[0]
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"fmt"
+	"net/http"
+
+	// Community
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Tracing
+//
+// Trace context is always propagated, in both W3C (traceparent, baggage) and
+// B3 multi-header form so that the spans emitted by Envoy and ztunnel join
+// the worker's. Spans are only exported when --worker-tracing-endpoint points
+// at an OTLP/gRPC collector; otherwise the no-op provider is kept and the
+// worker merely forwards the context it receives.
+//-----------------------------------------------------------------------------
+
+var tracer = otel.Tracer("github.com/h0tbird/k-swarm/pkg/worker")
+
+//-----------------------------------------------------------------------------
+// setupTracing installs the propagators and, if enabled, the OTLP exporter.
+// The returned func flushes and stops the exporter.
+//-----------------------------------------------------------------------------
+
+func setupTracing(ctx context.Context, flags *common.FlagPack) (func(context.Context) error, error) {
+
+	// Propagate W3C and B3 headers
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+		b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+	))
+
+	// Exporting is optional
+	if flags.WorkerTracingEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if flags.WorkerTracingSampleRatio < 0 || flags.WorkerTracingSampleRatio > 1 {
+		return nil, fmt.Errorf("tracing sample ratio must be in [0, 1], got %v", flags.WorkerTracingSampleRatio)
+	}
+
+	// Setup the exporter
+	exporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithEndpoint(flags.WorkerTracingEndpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+	}
+
+	// Describe the pod the way Istio names it: service peer in its namespace
+	self := localPeer()
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("peer"),
+		semconv.ServiceNamespace(self.Namespace),
+		semconv.K8SClusterName(self.Cluster),
+		semconv.K8SNamespaceName(self.Namespace),
+		semconv.K8SPodName(self.Pod),
+		semconv.K8SNodeName(self.Node),
+	)
+
+	// Install the provider, honouring the caller's sampling decision
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(flags.WorkerTracingSampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	log.Info("tracing enabled", "endpoint", flags.WorkerTracingEndpoint, "sample_ratio", flags.WorkerTracingSampleRatio)
+
+	return tp.Shutdown, nil
+}
+
+//-----------------------------------------------------------------------------
+// traceHandler wraps the worker server so every request gets a server span
+// named after its method and path.
+//-----------------------------------------------------------------------------
+
+func traceHandler(h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, "peer",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+	)
+}
@@ -0,0 +1,174 @@
+package worker
+
+import (
+
+	// Stdlib
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Service watch
+//
+// With --informer-watch the worker holds a Server-Sent Events stream to the
+// informer's /v1/services/watch and applies every update as soon as it is
+// pushed, so a new peer gets traffic within moments instead of after the
+// next poll. The informer sends a heartbeat every 15s; a stream that stays
+// silent for watchIdleTimeout is considered dead. While the stream is down,
+// polling takes over, and the watch reconnects with exponential backoff.
+//-----------------------------------------------------------------------------
+
+const (
+	watchIdleTimeout = 45 * time.Second
+	watchMaxBackoff  = 30 * time.Second
+	watchMaxEvent    = 16 << 20
+)
+
+var (
+	watching            atomic.Bool
+	errWatchUnsupported = errors.New("informer does not serve /v1/services/watch")
+)
+
+//-----------------------------------------------------------------------------
+// watchServiceList keeps a watch stream to the informer until the context is
+// done.
+//-----------------------------------------------------------------------------
+
+func watchServiceList(ctx context.Context, flags *common.FlagPack, reg *peerRegistry) {
+
+	backoff := time.Second
+	for {
+
+		// Stream until the connection breaks
+		url := flags.InformerURL + "/v1/services/watch"
+		log.Info("watching service list", "url", url)
+		streamed, err := streamServices(ctx, flags, url, reg)
+		watching.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Back off, from scratch if the stream got through
+		if streamed {
+			backoff = time.Second
+		}
+		switch {
+		case errors.Is(err, errWatchUnsupported):
+			backoff = watchMaxBackoff
+			log.V(1).Info("service watch unsupported, polling", "retry", backoff)
+		default:
+			log.Error(err, "service watch interrupted, polling", "retry", backoff)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, watchMaxBackoff)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// streamServices reads the watch stream, publishing every update to the
+// registry, and reports whether at least one update got through.
+//-----------------------------------------------------------------------------
+
+func streamServices(ctx context.Context, flags *common.FlagPack, url string, reg *peerRegistry) (bool, error) {
+
+	// Cancel the stream when it goes silent
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	idle := time.AfterFunc(watchIdleTimeout, cancel)
+	defer idle.Stop()
+
+	// Open the stream
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+
+	// Defer closing the response body
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Error(err, "failed to close response body")
+		}
+	}()
+
+	// Check the status code
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, errWatchUnsupported
+	default:
+		return false, fmt.Errorf("server returned non-200 status code: %d", resp.StatusCode)
+	}
+
+	// Read the events, dispatched on blank lines
+	streamed := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), watchMaxEvent)
+	var event string
+	var data strings.Builder
+	for scanner.Scan() {
+		idle.Reset(watchIdleTimeout)
+		line := scanner.Text()
+		switch {
+
+		// Dispatch
+		case line == "":
+			if event == "services" && data.Len() > 0 {
+				if flags.WorkerLogResponses {
+					log.Info("services event", "url", url, "body", data.String())
+				}
+				list, err := parseRecords([]byte(data.String()), protocols[flags.WorkerProtocol].port)
+				if err != nil {
+					return streamed, err
+				}
+				list.resync = !streamed
+				streamed = true
+				watching.Store(true)
+				applyServiceList(reg, list, "watch")
+			}
+			event = ""
+			data.Reset()
+
+		// Heartbeats and other comments
+		case strings.HasPrefix(line, ":"):
+
+		// Fields
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			}
+		}
+	}
+
+	// The stream only ends on errors
+	if err := scanner.Err(); err != nil {
+		return streamed, err
+	}
+	return streamed, io.ErrUnexpectedEOF
+}
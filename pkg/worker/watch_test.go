@@ -0,0 +1,178 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/internal/controller"
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// servicesEvent returns a services event listing peer in the given namespaces
+//-----------------------------------------------------------------------------
+
+func servicesEvent(generation int, namespaces ...string) string {
+	var services string
+	for i, ns := range namespaces {
+		if i > 0 {
+			services += ","
+		}
+		services += fmt.Sprintf(`{"name": "peer", "namespace": %q, "ports": [{"name": "http", "port": 80}], "readyEndpoints": 1}`, ns)
+	}
+	return fmt.Sprintf("event: services\ndata: {\"apiVersion\": %q, \"generation\": %d, \"services\": [%s]}\n\n",
+		controller.ServiceRecordsVersion, generation, services)
+}
+
+//-----------------------------------------------------------------------------
+// TestStreamServices serves a stream and checks what reached the registry
+//-----------------------------------------------------------------------------
+
+func TestStreamServices(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		status     int
+		stream     string
+		services   []string
+		generation uint64
+		streamed   bool
+		err        error
+	}{
+		{name: "unsupported", status: http.StatusNotFound, err: errWatchUnsupported},
+		{name: "server error", status: http.StatusInternalServerError},
+		{name: "no events", status: http.StatusOK, stream: ": heartbeat\n\n", err: io.ErrUnexpectedEOF},
+		{
+			name:       "one event",
+			status:     http.StatusOK,
+			stream:     servicesEvent(1, "n1", "n2"),
+			services:   []string{"peer.n1:80", "peer.n2:80"},
+			generation: 1,
+			streamed:   true,
+			err:        io.ErrUnexpectedEOF,
+		},
+		{
+			name:       "last event wins",
+			status:     http.StatusOK,
+			stream:     servicesEvent(1, "n1") + ": heartbeat\n\n" + servicesEvent(2, "n2"),
+			services:   []string{"peer.n2:80"},
+			generation: 2,
+			streamed:   true,
+			err:        io.ErrUnexpectedEOF,
+		},
+		{
+			name:       "data over several lines",
+			status:     http.StatusOK,
+			stream:     "event: services\ndata: {\"apiVersion\": \"v1\", \"generation\": 3,\ndata: \"services\": []}\n\n",
+			generation: 3,
+			streamed:   true,
+			err:        io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "other events ignored",
+			status: http.StatusOK,
+			stream: "event: ping\ndata: {}\n\ndata: {}\n\n",
+			err:    io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "unknown version",
+			status: http.StatusOK,
+			stream: "event: services\ndata: {\"apiVersion\": \"v0\"}\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Serve the stream, then end it
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.stream)
+			}))
+			defer srv.Close()
+
+			reg := newPeerRegistry()
+			streamed, err := streamServices(context.Background(), &common.FlagPack{WorkerProtocol: "http"}, srv.URL, reg)
+			if streamed != tt.streamed {
+				t.Errorf("got streamed %v, want %v", streamed, tt.streamed)
+			}
+			if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+			if got := reg.snapshot(); !slices.Equal(got, tt.services) {
+				t.Errorf("got services %v, want %v", got, tt.services)
+			}
+			if got := reg.generation.Load(); got != tt.generation {
+				t.Errorf("got generation %d, want %d", got, tt.generation)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestWatchServiceList drops the stream after every event and checks that the
+// watch reconnects, backing off in between, until the context is done.
+//-----------------------------------------------------------------------------
+
+func TestWatchServiceList(t *testing.T) {
+
+	var connects atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/services/watch" {
+			http.NotFound(w, r)
+			return
+		}
+		n := connects.Add(1)
+		_, _ = io.WriteString(w, servicesEvent(int(n), fmt.Sprintf("n%d", n)))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reg := newPeerRegistry()
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		watchServiceList(ctx, &common.FlagPack{InformerURL: srv.URL, WorkerProtocol: "http"}, reg)
+		close(done)
+	}()
+
+	// The list of the second connection comes after the first backoff
+	deadline := time.After(5 * time.Second)
+	for reg.generation.Load() < 2 {
+		select {
+		case <-deadline:
+			t.Fatal("the watch did not reconnect")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("reconnected after %s, want a backoff of at least 1s", elapsed)
+	}
+
+	if got := reg.snapshot(); !slices.Equal(got, []string{"peer.n2:80"}) {
+		t.Errorf("got services %v, want those of the second connection", got)
+	}
+
+	// The watch ends with the context
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the watch did not end with the context")
+	}
+}
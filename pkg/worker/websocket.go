@@ -0,0 +1,419 @@
+package worker
+
+import (
+
+	// Stdlib
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	// Community
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// Streams
+//
+// In websocket mode the worker holds one persistent connection to /ws on
+// every peer. On upgrade the server sends one hello message holding its
+// peerInfo as JSON, then echoes back every message it receives. Each request
+// scheduled for a peer becomes a heartbeat on its stream, and the time to
+// get the echo back is the hop duration.
+//
+// Streams keep themselves alive between heartbeats with a ping every third
+// of --worker-stream-idle-timeout, so that they persist however rarely the
+// scheduler picks their peer. A stream that hears nothing, neither an echo
+// nor a pong, for the idle timeout has timed out. A stream that breaks is
+// reported as a cut, with how long it had been up, and is re-established on
+// the next heartbeat. Streams to peers that leave the service list are
+// closed quietly.
+//-----------------------------------------------------------------------------
+
+const (
+	streamCutClosed  = "closed"
+	streamCutReset   = "reset"
+	streamCutTimeout = "timeout"
+)
+
+//-----------------------------------------------------------------------------
+// Metrics
+//-----------------------------------------------------------------------------
+
+var (
+	streamsOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "streams_open",
+		Help:      "Number of persistent streams currently held open by the worker.",
+	})
+
+	streamCuts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "stream_cuts_total",
+		Help:      "Number of persistent streams that broke, by reason: closed, reset or timeout.",
+	}, []string{"src_cluster", "src_namespace", "dst_cluster", "dst_namespace", "reason"})
+
+	streamLifetime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kswarm",
+		Subsystem: "worker",
+		Name:      "stream_lifetime_seconds",
+		Help:      "How long persistent streams stayed up before they were cut.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+	}, []string{"src_cluster", "src_namespace", "dst_cluster", "dst_namespace"})
+)
+
+func init() {
+	registry.MustRegister(streamsOpen, streamCuts, streamLifetime)
+}
+
+//-----------------------------------------------------------------------------
+// wsInfo groups stream-level fields under a single nested object in the log
+// line, mirroring httpInfo.
+//-----------------------------------------------------------------------------
+
+type wsInfo struct {
+	Seq         uint64 `json:"seq"`
+	StreamAgeMs int64  `json:"stream_age_ms"`
+	Reconnected bool   `json:"reconnected"`
+	Identity    string `json:"identity,omitempty"`
+}
+
+//-----------------------------------------------------------------------------
+// heartbeat is the message exchanged on a stream
+//-----------------------------------------------------------------------------
+
+type heartbeat struct {
+	Seq  uint64 `json:"seq"`
+	Sent int64  `json:"sent"`
+}
+
+//-----------------------------------------------------------------------------
+// getWS upgrades the connection, says hello and echoes messages back
+//-----------------------------------------------------------------------------
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+func getWS(c *gin.Context) {
+
+	// Upgrade
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.V(1).Info("websocket upgrade failed", "remote", c.Request.RemoteAddr, "error", err.Error())
+		return
+	}
+	wsConns.Store(conn, struct{}{})
+	defer func() {
+		wsConns.Delete(conn)
+		if err := conn.Close(); err != nil {
+			log.V(1).Info("failed to close websocket", "error", err.Error())
+		}
+	}()
+
+	// Say hello
+	if err := conn.WriteJSON(localPeer()); err != nil {
+		return
+	}
+
+	// Echo
+	for {
+		kind, msg, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.V(1).Info("websocket echo failed", "remote", c.Request.RemoteAddr, "error", err.Error())
+			}
+			return
+		}
+		if err := conn.WriteMessage(kind, msg); err != nil {
+			return
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// wsConns holds the server side of every open stream, so that shutdown can
+// close them with a going-away frame, which peers count as a clean close
+// rather than a reset.
+//-----------------------------------------------------------------------------
+
+var wsConns sync.Map
+
+func closeWSConns() {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down")
+	wsConns.Range(func(k, _ any) bool {
+		_ = k.(*websocket.Conn).WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		return true
+	})
+}
+
+//-----------------------------------------------------------------------------
+// stream is the client side of a persistent connection to one peer. Its
+// reader goroutine owns all reads and hands echoes to the heartbeat waiting
+// for them; mu serializes heartbeats so at most one is in flight.
+//-----------------------------------------------------------------------------
+
+type stream struct {
+	service  string
+	conn     *websocket.Conn
+	dst      peerInfo
+	identity string
+	opened   time.Time
+	idle     time.Duration
+	redial   bool
+
+	mu      sync.Mutex
+	seq     uint64
+	retired atomic.Bool
+	echoes  chan heartbeat
+	done    chan struct{}
+	err     error
+}
+
+//-----------------------------------------------------------------------------
+// validateStreams checks the stream idle timeout
+//-----------------------------------------------------------------------------
+
+func validateStreams(flags *common.FlagPack) error {
+	if flags.WorkerStreamIdleTimeout <= 0 {
+		return fmt.Errorf("stream idle timeout must be positive, got %v", flags.WorkerStreamIdleTimeout)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// streams caches one stream per destination, like grpcConns. dialed
+// remembers every destination ever dialed so that new streams can tell a
+// first connection from a reconnection.
+//-----------------------------------------------------------------------------
+
+var streams, dialed sync.Map
+
+//-----------------------------------------------------------------------------
+// openStream returns the stream to a peer, dialing a new one if there is
+// none.
+//-----------------------------------------------------------------------------
+
+func openStream(ctx context.Context, flags *common.FlagPack, service string) (*stream, error) {
+
+	// Reuse the current stream
+	if s, ok := streams.Load(service); ok {
+		return s.(*stream), nil
+	}
+
+	// Dial, carrying the trace context on the upgrade request
+	header := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	addr, cluster := splitDestination(service)
+	if cluster != "" {
+		header.Set(clusterHeader, cluster)
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = clientTLS
+	conn, _, err := dialer.DialContext(ctx, fmt.Sprintf("%s://%s/ws", scheme("ws"), addr), header)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the hello message
+	s := &stream{
+		service: service,
+		conn:    conn,
+		opened:  time.Now(),
+		idle:    flags.WorkerStreamIdleTimeout,
+		echoes:  make(chan heartbeat, 1),
+		done:    make(chan struct{}),
+	}
+	if tc, ok := conn.NetConn().(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		s.identity = peerIdentity(&state)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(s.idle))
+	if err := conn.ReadJSON(&s.dst); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to read hello message: %w", err)
+	}
+
+	// Publish the stream, unless another lane won the race, in which case
+	// the destination is only marked as dialed by the winner
+	_, s.redial = dialed.Load(service)
+	if prev, loaded := streams.LoadOrStore(service, s); loaded {
+		_ = conn.Close()
+		return prev.(*stream), nil
+	}
+	dialed.Store(service, struct{}{})
+	streamsOpen.Inc()
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.idle))
+	})
+	go s.read()
+	go s.keepAlive()
+	return s, nil
+}
+
+//-----------------------------------------------------------------------------
+// keepAlive pings the peer until the stream ends. Every pong, like every
+// echo, pushes the read deadline out by the idle timeout.
+//-----------------------------------------------------------------------------
+
+func (s *stream) keepAlive() {
+
+	ticker := time.NewTicker(s.idle / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.idle)); err != nil {
+				log.V(1).Info("failed to ping stream", "service", s.service, "error", err.Error())
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// closeStream closes the stream to a peer that left the service list
+//-----------------------------------------------------------------------------
+
+func closeStream(service string) {
+	if s, ok := streams.Load(service); ok {
+		s := s.(*stream)
+		s.retired.Store(true)
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "peer left")
+		_ = s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		_ = s.conn.Close()
+	}
+}
+
+//-----------------------------------------------------------------------------
+// read delivers echoes until the stream breaks, then tears it down
+//-----------------------------------------------------------------------------
+
+func (s *stream) read() {
+
+	for {
+		var msg heartbeat
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			s.close(err)
+			return
+		}
+		_ = s.conn.SetReadDeadline(time.Now().Add(s.idle))
+		select {
+		case s.echoes <- msg:
+		default:
+			// Late echo of a heartbeat that already gave up
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// close removes the stream from the cache and reports why it ended
+//-----------------------------------------------------------------------------
+
+func (s *stream) close(err error) {
+
+	// Tear down
+	streams.CompareAndDelete(s.service, s)
+	streamsOpen.Dec()
+	_ = s.conn.Close()
+	s.err = err
+	close(s.done)
+
+	// Streams to departed peers are not cut
+	if s.retired.Load() {
+		log.V(1).Info("stream closed, peer left", "service", s.service)
+		return
+	}
+
+	// Anything else is a cut. gorilla reports a connection dropped without a
+	// close frame as 1006, which is a reset rather than a clean close.
+	var netErr net.Error
+	timeout := errors.As(err, &netErr) && netErr.Timeout()
+	reason := streamCutReset
+	var closeErr *websocket.CloseError
+	switch {
+	case timeout:
+		reason = streamCutTimeout
+	case errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure:
+		reason = streamCutClosed
+	}
+	observeStreamCut(s.dst, s.service, reason, time.Since(s.opened))
+	log.Info("stream cut",
+		"service", s.service,
+		"dst", s.dst,
+		"reason", reason,
+		"lifetime_ms", time.Since(s.opened).Milliseconds(),
+		"error", err.Error(),
+	)
+}
+
+//-----------------------------------------------------------------------------
+// wsCall sends one heartbeat on the stream to a peer and waits for its echo
+//-----------------------------------------------------------------------------
+
+func wsCall(ctx context.Context, flags *common.FlagPack, service string) hopResult {
+
+	// Get a stream
+	start := time.Now()
+	s, err := openStream(ctx, flags, service)
+	if err != nil {
+		return hopResult{err: err, duration: time.Since(start)}
+	}
+
+	// One heartbeat at a time
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	info := wsInfo{Seq: s.seq, StreamAgeMs: time.Since(s.opened).Milliseconds(), Reconnected: s.redial && s.seq == 1, Identity: s.identity}
+
+	// Send the heartbeat. Its echo is due before the stream times out.
+	start = time.Now()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	}
+	if err := s.conn.WriteJSON(heartbeat{Seq: s.seq, Sent: start.UnixNano()}); err != nil {
+		return hopResult{err: fmt.Errorf("failed to send heartbeat: %w", err), duration: time.Since(start), info: info}
+	}
+
+	// Wait for the echo
+	for {
+		select {
+		case msg := <-s.echoes:
+			if msg.Seq != s.seq {
+				continue
+			}
+			return hopResult{dst: s.dst, duration: time.Since(start), info: info}
+		case <-s.done:
+			return hopResult{err: fmt.Errorf("stream cut: %w", s.err), duration: time.Since(start), info: info}
+		case <-ctx.Done():
+			return hopResult{err: ctx.Err(), duration: time.Since(start), info: info}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// observeStreamCut records a cut stream in the stream metrics
+//-----------------------------------------------------------------------------
+
+func observeStreamCut(dst peerInfo, service, reason string, lifetime time.Duration) {
+
+	labels := peerLabels(localPeer(), dst, service)
+	streamLifetime.With(labels).Observe(lifetime.Seconds())
+	labels["reason"] = reason
+	streamCuts.With(labels).Inc()
+}
@@ -0,0 +1,93 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	// Community
+	"github.com/gin-gonic/gin"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// TestOpenStream opens streams to a peer concurrently and checks that they
+// share the one published, which is not a reconnection, and that the next
+// stream once it is closed is.
+//-----------------------------------------------------------------------------
+
+func TestOpenStream(t *testing.T) {
+
+	// A peer serving /ws
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", getWS)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	service := strings.TrimPrefix(srv.URL, "http://")
+	defer dialed.Delete(service)
+	flags := &common.FlagPack{WorkerStreamIdleTimeout: time.Second}
+
+	// open opens streams concurrently and returns the one they share
+	open := func(t *testing.T, lanes int) *stream {
+		got := make([]*stream, lanes)
+		var wg sync.WaitGroup
+		for i := range lanes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s, err := openStream(context.Background(), flags, service)
+				if err != nil {
+					t.Error(err)
+				}
+				got[i] = s
+			}()
+		}
+		wg.Wait()
+		for _, s := range got[1:] {
+			if s != got[0] {
+				t.Fatal("lanes got different streams")
+			}
+		}
+		return got[0]
+	}
+
+	tests := []struct {
+		name   string
+		redial bool
+	}{
+		{name: "first connection", redial: false},
+		{name: "reconnection", redial: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := open(t, 8)
+			if s == nil {
+				t.Fatal("no stream opened")
+			}
+			if s.redial != tt.redial {
+				t.Errorf("got redial %v, want %v", s.redial, tt.redial)
+			}
+
+			// Close it for the next one
+			closeStream(service)
+			select {
+			case <-s.done:
+			case <-time.After(time.Second):
+				t.Fatal("the stream did not close")
+			}
+		})
+	}
+}
@@ -4,20 +4,27 @@ import (
 
 	// Stdlib
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	// Community
-	"github.com/fvbock/endless"
 	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	// Internal
+	"github.com/h0tbird/k-swarm/internal/controller"
 	"github.com/h0tbird/k-swarm/pkg/common"
 )
 
@@ -26,64 +33,168 @@ import (
 //-----------------------------------------------------------------------------
 
 var (
-	serviceList = []string{}
-	log         = ctrl.Log.WithName("peer")
+	log = ctrl.Log.WithName("peer")
 )
 
 //-----------------------------------------------------------------------------
 // Structs
 //-----------------------------------------------------------------------------
 
+// InformerData is the structured service list served by the informer under
+// /v1/services.
 type InformerData struct {
-	Services []string `json:"services"`
+	APIVersion string                     `json:"apiVersion"`
+	Generation uint64                     `json:"generation"`
+	Services   []controller.ServiceRecord `json:"services"`
+}
+
+// legacyInformerData is the flat service list served under /services by
+// informers that predate the structured records.
+type legacyInformerData struct {
+	Services []string            `json:"services"`
+	Ports    map[string][]string `json:"ports"`
 }
 
 //-----------------------------------------------------------------------------
-// Start starts the worker
+// Start starts the worker and returns once it is done, with the error that
+// stopped it, if any.
 //-----------------------------------------------------------------------------
 
-func Start(ctx context.Context, wg *sync.WaitGroup, flags *common.FlagPack) {
+func Start(ctx context.Context, wg *sync.WaitGroup, flags *common.FlagPack) error {
 
 	defer wg.Done()
 
+	// Setup tracing
+	shutdown, err := setupTracing(ctx, flags)
+	if err != nil {
+		return fmt.Errorf("unable to setup tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Error(err, "failed to flush traces")
+		}
+	}()
+
+	// Seed the fault config from the flags
+	if err := setupFaults(flags); err != nil {
+		return fmt.Errorf("unable to setup fault injection: %w", err)
+	}
+
+	// Size the destination stats
+	if err := setupStats(flags); err != nil {
+		return fmt.Errorf("unable to setup destination stats: %w", err)
+	}
+
+	// Check the readiness knobs
+	if err := validateReadiness(flags); err != nil {
+		return fmt.Errorf("unable to setup readiness: %w", err)
+	}
+
+	// Load the TLS material, if any
+	serverTLS, err := setupTLS(flags)
+	if err != nil {
+		return fmt.Errorf("unable to setup tls: %w", err)
+	}
+
+	// Build the HTTP client for the connection mode
+	if err := setupConns(ctx, flags); err != nil {
+		return fmt.Errorf("unable to setup http client connections: %w", err)
+	}
+
+	// Open the hop record sink, if any
+	closeRecords, err := setupRecords(flags)
+	if err != nil {
+		return fmt.Errorf("unable to setup hop records: %w", err)
+	}
+	defer closeRecords()
+
+	// Load the traffic scenario, if any
+	if err := setupScenario(ctx, flags); err != nil {
+		return fmt.Errorf("unable to setup the traffic scenario: %w", err)
+	}
+
+	// A server that fails takes the whole worker down
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var servers sync.WaitGroup
+	var failed sync.Once
+	var serveErr error
+	serve := func(name string, fn func(context.Context) error) {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			if err := fn(ctx); err != nil {
+				failed.Do(func() { serveErr = fmt.Errorf("worker %s server failed: %w", name, err) })
+				cancel()
+			}
+		}()
+	}
+
 	// Worker server respons /data
-	go server(flags)
+	serve("http", func(ctx context.Context) error { return server(ctx, flags, serverTLS) })
+
+	// Worker gRPC server responds kswarm.v1.Peer/GetData
+	serve("grpc", func(ctx context.Context) error { return grpcServer(ctx, flags) })
+
+	// Worker TCP server echoes framed payloads
+	serve("tcp", func(ctx context.Context) error { return tcpServer(ctx, flags) })
+
+	// Worker metrics server responds /metrics and the health probes
+	serve("metrics", func(ctx context.Context) error { return metricsServer(ctx, flags) })
+
+	// Worker probe server responds the health probes, if on their own listener
+	serve("probe", func(ctx context.Context) error { return probeServer(ctx, flags) })
 
-	// Worker client requests /data
-	client(ctx, flags)
+	// Worker admin server changes the fault config at runtime, if enabled
+	serve("admin", func(ctx context.Context) error { return adminServer(ctx, flags) })
+
+	// Worker client requests /data until the context is done and its
+	// in-flight requests have completed, while the servers drain. A client
+	// that cannot start takes the servers down with it.
+	clientErr := client(ctx, flags)
+	cancel()
+	servers.Wait()
+	if clientErr != nil {
+		return clientErr
+	}
+	return serveErr
 }
 
 //-----------------------------------------------------------------------------
-// server starts the worker server
+// server runs the worker server until the context is done and the drain
+// period is over.
 //-----------------------------------------------------------------------------
 
-func server(flags *common.FlagPack) {
+func server(ctx context.Context, flags *common.FlagPack, tlsConfig *tls.Config) error {
 
 	// Setup the router
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	router.Use(gin.Recovery())
 	if err := router.SetTrustedProxies(nil); err != nil {
-		log.Error(err, "unable to set trusted proxies")
-		os.Exit(1)
+		return fmt.Errorf("unable to set trusted proxies: %w", err)
 	}
 
 	// Routes
-	router.GET("/data", getData)
-
-	// Start the server
-	if err := endless.ListenAndServe(flags.WorkerBindAddr, router); err != nil {
-		log.Error(err, "unable to start worker server")
-		os.Exit(1)
+	router.Match([]string{http.MethodGet, http.MethodPost, http.MethodPut}, "/data", injectFaults, getData(flags))
+	router.GET("/ws", getWS)
+	router.GET("/stats", getStats)
+
+	// Start the server, closing streams cleanly on shutdown
+	srv := &http.Server{
+		Addr:              flags.WorkerBindAddr,
+		Handler:           traceHandler(router),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
-}
-
-//-----------------------------------------------------------------------------
-// getData
-//-----------------------------------------------------------------------------
-
-func getData(c *gin.Context) {
-	c.JSON(200, localPeer())
+	srv.RegisterOnShutdown(closeWSConns)
+	listen := srv.ListenAndServe
+	if tlsConfig != nil {
+		listen = func() error { return srv.ListenAndServeTLS(flags.WorkerTLSCertFile, flags.WorkerTLSKeyFile) }
+	}
+	return common.Serve(ctx, srv, flags.ShutdownDrainPeriod, listen)
 }
 
 //-----------------------------------------------------------------------------
@@ -102,64 +213,210 @@ func localPeer() peerInfo {
 }
 
 //-----------------------------------------------------------------------------
-// client starts the worker client
+// client runs the worker client until the context is done, or returns the
+// error that kept it from starting.
 //-----------------------------------------------------------------------------
 
-func client(ctx context.Context, flags *common.FlagPack) {
+func client(ctx context.Context, flags *common.FlagPack) error {
 
 	// Bind the worker's own identity to the logger so every line is
 	// self-describing as "src -> dst" when tailing logs from many pods.
-	log := log.WithValues("src", localPeer())
+	src := localPeer()
+	log := log.WithValues("src", src)
+
+	// Validate the protocol
+	if _, ok := protocols[flags.WorkerProtocol]; !ok {
+		return fmt.Errorf("unable to setup the client: unknown protocol %q", flags.WorkerProtocol)
+	}
+
+	// Validate the retry policy
+	if err := validateRetries(flags); err != nil {
+		return fmt.Errorf("unable to setup the client: %w", err)
+	}
+
+	// Validate the tcp frames
+	if err := validateTCP(flags); err != nil {
+		return fmt.Errorf("unable to setup the client: %w", err)
+	}
+
+	// Validate the streams
+	if err := validateStreams(flags); err != nil {
+		return fmt.Errorf("unable to setup the client: %w", err)
+	}
+
+	// Validate the call chains
+	if err := validateChain(flags.WorkerChainDepth, flags.WorkerChainFanout); err != nil {
+		return fmt.Errorf("unable to setup the client: %w", err)
+	}
+
+	// Setup the scheduler
+	sched, err := newScheduler(flags, func(ctx context.Context, service string) {
+		hop(ctx, log, flags, src, service)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to setup the scheduler: %w", err)
+	}
 
 	// Get the service list from the informer
-	go pollServiceList(ctx, flags, &serviceList)
+	changes := peers.subscribe()
+	go pollServiceList(ctx, flags, peers)
+	if flags.InformerWatch {
+		go watchServiceList(ctx, flags, peers)
+	}
+
+	// Run the dispatcher
+	go sched.run(ctx)
 
-	// Loop over the service list and make requests to /data
+	// Keep the scheduler lanes in sync with the service list, as filtered
+	// by the scenario
+	sched.sync(ctx, scenarios.load().filter(peers.snapshot()))
 	for {
 		select {
+		case <-changes:
+			sched.sync(ctx, scenarios.load().filter(peers.snapshot()))
+		case <-scenarios.changed:
+			sched.sync(ctx, scenarios.load().filter(peers.snapshot()))
 		case <-ctx.Done():
-			log.Info("client context done")
+			log.Info("client context done, waiting for requests in flight")
+			sched.wait(flags.ShutdownDrainPeriod + common.ShutdownTimeout)
+			return nil
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// protocol is a way of calling peers. port is the advertised Service port
+// name whose addresses the worker targets when the protocol is selected.
+//-----------------------------------------------------------------------------
+
+type protocol struct {
+	port string
+	call func(ctx context.Context, flags *common.FlagPack, service string) hopResult
+}
+
+var protocols = map[string]protocol{
+	"http": {port: "http", call: httpCall},
+	"grpc": {port: "grpc", call: grpcCall},
+	"tcp":  {port: "tcp", call: tcpCall},
+
+	// Streams share the http port: /ws is served next to /data.
+	"websocket": {port: "http", call: wsCall},
+}
+
+//-----------------------------------------------------------------------------
+// hopResult is the outcome of a single call to a peer. status is an HTTP
+// status code (gRPC codes are mapped to their HTTP equivalent, tcp and
+// websocket leave it at zero) and info holds the protocol-specific fields
+// logged under the protocol's name.
+//-----------------------------------------------------------------------------
+
+type hopResult struct {
+	dst      peerInfo
+	status   int
+	err      error
+	duration time.Duration
+	body     []byte
+	info     any
+	chain    *chainNode
+	attempts int
+}
+
+//-----------------------------------------------------------------------------
+// hop makes a single call to a peer and records its outcome
+//-----------------------------------------------------------------------------
+
+func hop(ctx context.Context, log logr.Logger, flags *common.FlagPack, src peerInfo, service string) {
+
+	// Trace the hop, so the log line can point at it
+	ctx, span := tracer.Start(ctx, "hop", trace.WithAttributes(
+		attribute.String("kswarm.protocol", flags.WorkerProtocol),
+		attribute.String("kswarm.service", service),
+	))
+	defer span.End()
+	var traceID string
+	if sc := span.SpanContext(); sc.IsSampled() {
+		traceID = sc.TraceID().String()
+		log = log.WithValues("trace_id", traceID)
+	}
+
+	// Call the peer, retrying and hedging as configured
+	res := call(ctx, flags, service)
+	if res.attempts > 1 {
+		log = log.WithValues("attempts", res.attempts)
+	}
+	unready := peers.isUnready(service)
+	observeHop(src, res.dst, service, res.status, res.err, res.duration, unready)
+	observeDestination(service, res.dst)
+	stats.record(service, res)
+	recordHop(flags, src, service, res, traceID, unready)
+	if res.err != nil {
+		span.RecordError(res.err)
+		span.SetStatus(codes.Error, res.err.Error())
+		if res.info != nil {
+			log = log.WithValues(flags.WorkerProtocol, res.info)
+		}
+		if unready {
+			log.Info("request to unready destination failed", "service", service, "error", res.err.Error())
 			return
-		default:
-			for _, service := range serviceList {
-				time.Sleep(flags.WorkerRequestInterval)
-				start := time.Now()
-				resp, err := http.Get(fmt.Sprintf("http://%s/data", service))
-				if err != nil {
-					log.Error(err, "request failed", "service", service)
-					continue
-				}
-				durationMs := time.Since(start).Milliseconds()
-				body, readErr := io.ReadAll(resp.Body)
-				if cerr := resp.Body.Close(); cerr != nil {
-					log.Error(cerr, "failed to close response body", "service", service)
-				}
-				if readErr != nil {
-					log.Error(readErr, "failed to read response body", "service", service)
-					continue
-				}
-				if !flags.WorkerLogResponses {
-					continue
-				}
-				var dst peerInfo
-				if err := json.Unmarshal(body, &dst); err != nil {
-					// Fallback: log the raw body if it isn't the expected shape.
-					log.Info("hop",
-						"service", service,
-						"http", httpInfo{Status: resp.StatusCode},
-						"duration_ms", durationMs,
-						"body", string(body),
-					)
-					continue
-				}
-				log.Info("hop",
-					"dst", dst,
-					"http", httpInfo{Status: resp.StatusCode},
-					"duration_ms", durationMs,
-				)
-			}
 		}
+		log.Error(res.err, "request failed", "service", service)
+		return
+	}
+	if res.chain != nil {
+		observeChain(res.chain, res.duration)
+	}
+
+	// Optionally log the hop
+	if !flags.WorkerLogResponses {
+		return
+	}
+	if res.body != nil {
+		// Fallback: log the raw body if it isn't the expected shape.
+		log.Info("hop",
+			"service", service,
+			flags.WorkerProtocol, res.info,
+			"duration_ms", res.duration.Milliseconds(),
+			"body", string(res.body),
+		)
+		return
 	}
+	if res.chain != nil {
+		log.Info("hop",
+			"dst", res.dst,
+			flags.WorkerProtocol, res.info,
+			"duration_ms", res.duration.Milliseconds(),
+			"chain", res.chain.Next,
+		)
+		return
+	}
+	log.Info("hop",
+		"dst", res.dst,
+		flags.WorkerProtocol, res.info,
+		"duration_ms", res.duration.Milliseconds(),
+	)
+}
+
+//-----------------------------------------------------------------------------
+// httpCall makes a single request to a peer's /data endpoint
+//-----------------------------------------------------------------------------
+
+func httpCall(ctx context.Context, flags *common.FlagPack, service string) hopResult {
+
+	// Call the peer
+	node, status, body, duration, err := fetchData(ctx, service, flags.WorkerChainDepth, flags.WorkerChainFanout)
+	if err != nil {
+		return hopResult{err: err, duration: duration, info: httpInfo{Status: status, Phases: node.Phases}}
+	}
+
+	// Keep the call tree, if the peer forwarded the request. The phases of
+	// the call belong to the hop, not to the root node.
+	info := httpInfo{Status: status, Identity: node.Identity, Phases: node.Phases}
+	node.Phases = nil
+	res := hopResult{dst: node.peerInfo, status: status, duration: duration, body: body, info: info}
+	if node.Next != nil {
+		res.chain = &node
+	}
+	return res
 }
 
 //-----------------------------------------------------------------------------
@@ -181,30 +438,45 @@ type peerInfo struct {
 //-----------------------------------------------------------------------------
 
 type httpInfo struct {
-	Status int `json:"status"`
+	Status   int     `json:"status"`
+	Identity string  `json:"identity,omitempty"`
+	Phases   *phases `json:"phases_ms,omitempty"`
 }
 
 //-----------------------------------------------------------------------------
-// pollServiceList polls the service list from the informer
+// pollServiceList polls the service list from the informer, right away and
+// then on every tick that does not find the watch stream up.
 //-----------------------------------------------------------------------------
 
-func pollServiceList(ctx context.Context, flags *common.FlagPack, serviceList *[]string) {
+func pollServiceList(ctx context.Context, flags *common.FlagPack, reg *peerRegistry) {
+
+	// Fetch the list unless it is already streamed
+	var etag string
+	poll := func() {
+		if watching.Load() {
+			return
+		}
+		log.Info("polling service list", "url", flags.InformerURL, "generation", reg.generation.Load())
+		list, err := fetchServices(ctx, flags, flags.InformerURL, protocols[flags.WorkerProtocol].port, etag)
+		if err != nil {
+			log.Error(err, "failed to fetch services")
+			return
+		}
+		if list.notModified {
+			return
+		}
+		etag = list.etag
+		applyServiceList(reg, list, "poll")
+	}
 
-	// Setup a ticker
+	// Poll once, then on every tick
+	poll()
 	ticker := time.NewTicker(flags.InformerPollInterval)
 	defer ticker.Stop()
-
-	// Loop
 	for {
 		select {
 		case <-ticker.C:
-			log.Info("polling service list", "url", flags.InformerURL+"/services")
-			newServices, err := fetchServices(flags.InformerURL+"/services", flags.WorkerLogResponses)
-			if err != nil {
-				log.Error(err, "failed to fetch services")
-				continue
-			}
-			*serviceList = newServices
+			poll()
 		case <-ctx.Done():
 			log.Info("client context done")
 			return
@@ -213,15 +485,226 @@ func pollServiceList(ctx context.Context, flags *common.FlagPack, serviceList *[
 }
 
 //-----------------------------------------------------------------------------
-// fetchServices fetches the services from the informer
+// serviceList is a service list fetched from the informer. Informers that
+// predate generations and ETags leave them zero. A resync list, the first of
+// a watch stream, may come from another informer replica or a restarted one,
+// whose generations are not comparable with those seen so far.
 //-----------------------------------------------------------------------------
 
-func fetchServices(url string, logBody bool) ([]string, error) {
+type serviceList struct {
+	services    []string
+	unready     []string
+	generation  uint64
+	etag        string
+	notModified bool
+	resync      bool
+}
+
+//-----------------------------------------------------------------------------
+// applyServiceList publishes a fetched list to the registry, logging how it
+// changed and the generation it came with. Streams and gRPC connections to
+// the peers that left are closed. The poller and the watch apply their lists
+// one at a time, and a list older than the one in effect, such as a poll
+// that raced with the watch, is ignored unless it resyncs.
+//-----------------------------------------------------------------------------
+
+var applyMu sync.Mutex
+
+func applyServiceList(reg *peerRegistry, list serviceList, source string) {
+
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	// Stale
+	if current := reg.generation.Load(); !list.resync && list.generation < current {
+		log.V(1).Info("ignoring stale service list", "generation", list.generation, "current", current, "source", source)
+		return
+	}
+
+	// Publish
+	diff := reg.update(list.services, list.unready)
+	for _, service := range diff.removed {
+		closeStream(service)
+	}
+	closeGRPCConns(list.services)
+	if advanced := reg.advance(list.generation); advanced || !diff.empty() {
+		log.Info("service list changed", "generation", list.generation, "added", diff.added, "removed", diff.removed, "unready", list.unready, "source", source)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// fetchServices fetches from the informer the services advertising the given
+// port name. With the ETag of the last list, an informer where nothing
+// changed answers 304 and the list comes back flagged as not modified.
+// Informers without /v1/services are asked for the flat list instead, and
+// those that predate per-port lists only know about http.
+//-----------------------------------------------------------------------------
+
+func fetchServices(ctx context.Context, flags *common.FlagPack, informerURL, port, etag string) (serviceList, error) {
+
+	// Structured records
+	resp, err := fetchInformer(ctx, flags, informerURL+"/v1/services", etag)
+	switch {
+	case err != nil:
+		return serviceList{}, err
+	case resp.status == http.StatusNotModified:
+		return serviceList{etag: etag, notModified: true}, nil
+	case resp.status == http.StatusOK:
+		list, err := parseRecords(resp.body, port)
+		list.etag = resp.etag
+		return list, err
+
+	// Flat list from older informers
+	case resp.status == http.StatusNotFound:
+		resp, err = fetchInformer(ctx, flags, informerURL+"/services", etag)
+		if err != nil {
+			return serviceList{}, err
+		}
+		if resp.status == http.StatusNotModified {
+			return serviceList{etag: etag, notModified: true}, nil
+		}
+		if resp.status != http.StatusOK {
+			return serviceList{}, fmt.Errorf("server returned non-200 status code: %d", resp.status)
+		}
+		var data legacyInformerData
+		if err := json.Unmarshal(resp.body, &data); err != nil {
+			return serviceList{}, err
+		}
+		list := data.Ports[port]
+		if data.Ports == nil && port == "http" {
+			list = data.Services
+		}
+		return serviceList{services: nonEmpty(list), etag: resp.etag}, nil
+
+	default:
+		return serviceList{}, fmt.Errorf("server returned non-200 status code: %d", resp.status)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// parseRecords returns the destinations of the given port name in a
+// structured service list, along with its generation and the destinations
+// without ready endpoints.
+//-----------------------------------------------------------------------------
+
+func parseRecords(body []byte, port string) (serviceList, error) {
+
+	var data InformerData
+	if err := json.Unmarshal(body, &data); err != nil {
+		return serviceList{}, err
+	}
+	if data.APIVersion != controller.ServiceRecordsVersion {
+		return serviceList{}, fmt.Errorf("unsupported service records version %q", data.APIVersion)
+	}
+
+	// Find the addresses that several clusters share
+	clusters := map[string]map[string]bool{}
+	for _, record := range data.Services {
+		addr := record.Address(port)
+		if clusters[addr] == nil {
+			clusters[addr] = map[string]bool{}
+		}
+		clusters[addr][record.Cluster] = true
+	}
+
+	// Give each of their clusters a destination of its own. Raw TCP carries
+	// no header to route on, so the mesh picks the cluster of a shared tcp
+	// address, which is then ready if any of its clusters is.
+	var list []string
+	ready := map[string]bool{}
+	for _, record := range data.Services {
+		dest := record.Address(port)
+		if dest == "" {
+			continue
+		}
+		if len(clusters[dest]) > 1 && port != protocols["tcp"].port {
+			dest = joinDestination(dest, record.Cluster)
+		}
+		if !slices.Contains(list, dest) {
+			list = append(list, dest)
+		}
+		ready[dest] = ready[dest] || record.Ready()
+	}
+	var unready []string
+	for _, dest := range list {
+		if !ready[dest] {
+			unready = append(unready, dest)
+		}
+	}
+	return serviceList{services: list, unready: unready, generation: data.Generation}, nil
+}
+
+//-----------------------------------------------------------------------------
+// A destination is the name.namespace:port address of a peer Service, with
+// an @cluster suffix when the Service exists in several clusters of the
+// federation and calls must reach that one. The address is what is dialed;
+// the cluster travels in the clusterHeader, which the mesh routes to the
+// subset of that cluster.
+//-----------------------------------------------------------------------------
+
+const clusterHeader = "X-K-Swarm-Cluster"
+
+func joinDestination(addr, cluster string) string {
+	if cluster == "" {
+		return addr
+	}
+	return addr + "@" + cluster
+}
+
+func splitDestination(dest string) (addr, cluster string) {
+	addr, cluster, _ = strings.Cut(dest, "@")
+	return addr, cluster
+}
+
+//-----------------------------------------------------------------------------
+// nonEmpty filters out any services with empty names
+//-----------------------------------------------------------------------------
+
+func nonEmpty(list []string) []string {
+	var services []string
+	for _, service := range list {
+		if service != "" {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+//-----------------------------------------------------------------------------
+// informerResponse is what fetchInformer got back
+//-----------------------------------------------------------------------------
+
+type informerResponse struct {
+	status int
+	etag   string
+	body   []byte
+}
+
+//-----------------------------------------------------------------------------
+// fetchInformer gets a URL from the informer, conditionally on the ETag if
+// one is given.
+//-----------------------------------------------------------------------------
+
+func fetchInformer(ctx context.Context, flags *common.FlagPack, url, etag string) (informerResponse, error) {
+
+	// Bound the request
+	if flags.WorkerRequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flags.WorkerRequestTimeout)
+		defer cancel()
+	}
 
 	// Get the services
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return informerResponse{}, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, err
+		return informerResponse{}, err
 	}
 
 	// Defer closing the response body
@@ -231,36 +714,16 @@ func fetchServices(url string, logBody bool) ([]string, error) {
 		}
 	}()
 
-	// Check the status code
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned non-200 status code: %d", resp.StatusCode)
-	}
-
 	// Read the body
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return informerResponse{}, err
 	}
 
 	// Optionally log the raw response body
-	if logBody {
+	if flags.WorkerLogResponses && resp.StatusCode == http.StatusOK {
 		log.Info("services response", "url", url, "body", string(bodyBytes))
 	}
 
-	// Unmarshal the body
-	var data InformerData
-	if err := json.Unmarshal(bodyBytes, &data); err != nil {
-		return nil, err
-	}
-
-	// Filter out any services with empty names
-	var services []string
-	for _, service := range data.Services {
-		if service != "" {
-			services = append(services, service)
-		}
-	}
-
-	// Return the list
-	return services, nil
+	return informerResponse{status: resp.StatusCode, etag: resp.Header.Get("ETag"), body: bodyBytes}, nil
 }
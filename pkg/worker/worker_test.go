@@ -0,0 +1,206 @@
+package worker
+
+//-----------------------------------------------------------------------------
+// Imports
+//-----------------------------------------------------------------------------
+
+import (
+
+	// Stdlib
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	// Internal
+	"github.com/h0tbird/k-swarm/internal/controller"
+	"github.com/h0tbird/k-swarm/pkg/common"
+)
+
+//-----------------------------------------------------------------------------
+// TestFetchServices
+//-----------------------------------------------------------------------------
+
+func TestFetchServices(t *testing.T) {
+
+	records := `{"apiVersion": "` + controller.ServiceRecordsVersion + `", "generation": 2, "services": [` +
+		`{"name": "peer", "namespace": "n1", "ports": [{"name": "http", "port": 80}], "readyEndpoints": 1}]}`
+	legacy := `{"services": ["peer.n1:80"], "ports": {"http": ["peer.n1:80"]}}`
+
+	// serve answers path with body and etag, honouring If-None-Match, and
+	// 404 on every other path
+	serve := func(path, body, etag string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path != path:
+				http.NotFound(w, r)
+			case r.Header.Get("If-None-Match") == etag:
+				w.WriteHeader(http.StatusNotModified)
+			default:
+				w.Header().Set("ETag", etag)
+				_, _ = w.Write([]byte(body))
+			}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		etag        string
+		services    []string
+		wantETag    string
+		notModified bool
+		err         bool
+	}{
+		{name: "records", handler: serve("/v1/services", records, `"2-a"`), services: []string{"peer.n1:80"}, wantETag: `"2-a"`},
+		{name: "records not modified", handler: serve("/v1/services", records, `"2-a"`), etag: `"2-a"`, wantETag: `"2-a"`, notModified: true},
+		{name: "records changed", handler: serve("/v1/services", records, `"3-b"`), etag: `"2-a"`, services: []string{"peer.n1:80"}, wantETag: `"3-b"`},
+		{name: "legacy", handler: serve("/services", legacy, `"1-c"`), services: []string{"peer.n1:80"}, wantETag: `"1-c"`},
+		{name: "legacy not modified", handler: serve("/services", legacy, `"1-c"`), etag: `"1-c"`, wantETag: `"1-c"`, notModified: true},
+		{name: "error", handler: func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusInternalServerError) }, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			list, err := fetchServices(context.Background(), &common.FlagPack{}, srv.URL, "http", tt.etag)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if !slices.Equal(list.services, tt.services) || list.etag != tt.wantETag || list.notModified != tt.notModified {
+				t.Errorf("got services %v etag %q not modified %v, want services %v etag %q not modified %v",
+					list.services, list.etag, list.notModified, tt.services, tt.wantETag, tt.notModified)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestParseRecords
+//-----------------------------------------------------------------------------
+
+func TestParseRecords(t *testing.T) {
+
+	// record lists peer in namespace ns of cluster, with an http and a tcp port
+	record := func(ns, cluster string, ready int) string {
+		return fmt.Sprintf(`{"name": "peer", "namespace": %q, "cluster": %q, "readyEndpoints": %d, `+
+			`"ports": [{"name": "http", "port": 80}, {"name": "tcp", "port": 7000}]}`, ns, cluster, ready)
+	}
+	doc := func(records ...string) string {
+		return `{"apiVersion": "` + controller.ServiceRecordsVersion + `", "generation": 7, "services": [` + strings.Join(records, ", ") + `]}`
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		port     string
+		services []string
+		unready  []string
+		err      bool
+	}{
+		{name: "empty", body: doc(), port: "http"},
+		{name: "by port", body: doc(record("n1", "", 1), record("n2", "", 1)), port: "tcp", services: []string{"peer.n1:7000", "peer.n2:7000"}},
+		{name: "port not advertised", body: doc(record("n1", "", 1)), port: "grpc"},
+		{name: "one cluster each", body: doc(record("n1", "east", 1), record("n2", "west", 1)), port: "http", services: []string{"peer.n1:80", "peer.n2:80"}},
+		{
+			name:     "shared across clusters",
+			body:     doc(record("n1", "east", 1), record("n1", "west", 1), record("n2", "west", 1)),
+			port:     "http",
+			services: []string{"peer.n1:80@east", "peer.n1:80@west", "peer.n2:80"},
+		},
+		{
+			name:     "shared tcp address",
+			body:     doc(record("n1", "east", 0), record("n1", "west", 1)),
+			port:     "tcp",
+			services: []string{"peer.n1:7000"},
+		},
+		{
+			name:     "unready",
+			body:     doc(record("n1", "", 0), record("n2", "", 2)),
+			port:     "http",
+			services: []string{"peer.n1:80", "peer.n2:80"},
+			unready:  []string{"peer.n1:80"},
+		},
+		{
+			name:     "unready in one cluster",
+			body:     doc(record("n1", "east", 0), record("n1", "west", 1)),
+			port:     "http",
+			services: []string{"peer.n1:80@east", "peer.n1:80@west"},
+			unready:  []string{"peer.n1:80@east"},
+		},
+		{name: "unknown version", body: `{"apiVersion": "v0", "services": []}`, port: "http", err: true},
+		{name: "malformed", body: `{"services": `, port: "http", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := parseRecords([]byte(tt.body), tt.port)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !slices.Equal(list.services, tt.services) || !slices.Equal(list.unready, tt.unready) || list.generation != 7 {
+				t.Errorf("got services %v unready %v generation %d, want %v, %v and 7", list.services, list.unready, list.generation, tt.services, tt.unready)
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestApplyServiceList applies lists in turn and checks that those older than
+// the one in effect are ignored unless they resync.
+//-----------------------------------------------------------------------------
+
+func TestApplyServiceList(t *testing.T) {
+
+	reg := newPeerRegistry()
+	steps := []struct {
+		name       string
+		list       serviceList
+		services   []string
+		generation uint64
+	}{
+		{
+			name:       "first list",
+			list:       serviceList{services: []string{"a:80"}, generation: 2},
+			services:   []string{"a:80"},
+			generation: 2,
+		},
+		{
+			name:       "stale list",
+			list:       serviceList{services: []string{"b:80"}, generation: 1},
+			services:   []string{"a:80"},
+			generation: 2,
+		},
+		{
+			name:       "newer list",
+			list:       serviceList{services: []string{"a:80", "b:80"}, generation: 3},
+			services:   []string{"a:80", "b:80"},
+			generation: 3,
+		},
+		{
+			name:       "resync from another replica",
+			list:       serviceList{services: []string{"c:80"}, generation: 1, resync: true},
+			services:   []string{"c:80"},
+			generation: 1,
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			applyServiceList(reg, step.list, "test")
+			if got := reg.snapshot(); !slices.Equal(got, step.services) {
+				t.Errorf("got services %v, want %v", got, step.services)
+			}
+			if got := reg.generation.Load(); got != step.generation {
+				t.Errorf("got generation %d, want %d", got, step.generation)
+			}
+		})
+	}
+}